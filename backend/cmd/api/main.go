@@ -8,6 +8,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/config"
 	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/server"
 )
 
@@ -37,7 +38,12 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 
 func main() {
 
-	server := server.NewServer()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	server := server.NewServer(cfg)
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
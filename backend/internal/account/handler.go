@@ -0,0 +1,113 @@
+package account
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+)
+
+type AccountHandler struct {
+	accountService *AccountService
+	userService    *user.UserService
+	auditLog       *audit.AuditService
+	secureCookies  bool
+}
+
+func NewAccountHandler(accountService *AccountService, userService *user.UserService, auditLog *audit.AuditService, secureCookies bool) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+		userService:    userService,
+		auditLog:       auditLog,
+		secureCookies:  secureCookies,
+	}
+}
+
+// ExportAccount sends the signed-in user a zip archive of their data.
+func (h *AccountHandler) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Build the whole archive first, so a failure can still be reported
+	// with a proper status.
+	var buf bytes.Buffer
+	if err := h.accountService.Export(r.Context(), caller, &buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionAccountExport, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetUser, caller.ID.Hex()))
+
+	filename := fmt.Sprintf("account-%s-%s.zip", caller.ID.Hex(), time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Write(buf.Bytes())
+}
+
+// DeleteAccount deletes the signed-in user's account. The request says
+// whether their polls go to another account or are deleted, and whether
+// their other ballots are anonymized or removed.
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Polls      PollDisposition `json:"polls"`
+		TransferTo string          `json:"transfer_to"`
+		Votes      VoteDisposition `json:"votes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := DeleteOptions{Polls: req.Polls, Votes: req.Votes}
+	if opts.Votes == "" {
+		opts.Votes = VotesAnonymize
+	}
+	if opts.Polls == PollsTransfer {
+		if target, err := h.userService.GetUserByEmail(strings.TrimSpace(req.TransferTo)); err == nil {
+			opts.TransferTo = target
+		}
+	}
+
+	result, err := h.accountService.Delete(r.Context(), caller, opts)
+	var notMember *NotMemberError
+	switch {
+	case err == nil:
+	case errors.As(err, &notMember), err == ErrInvalidPollDisposition, err == ErrInvalidVoteDisposition,
+		err == ErrNoTransferTarget, err == ErrTransferToSelf, err == ErrTransferTargetUnverified:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	event := audit.NewEvent(r, audit.ActionAccountDelete, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetUser, caller.ID.Hex()).
+		With("polls", string(opts.Polls)).
+		With("votes", string(opts.Votes))
+	if opts.TransferTo != nil {
+		event = event.With("transfer_to", opts.TransferTo.ID.Hex())
+	}
+	h.auditLog.Record(r.Context(), event)
+
+	session.ClearCookie(w, h.secureCookies)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,85 @@
+package account
+
+import (
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/poll"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PollDisposition says what happens to a deleted account's polls.
+type PollDisposition string
+
+const (
+	// PollsTransfer hands the polls, with their votes, to another account.
+	PollsTransfer PollDisposition = "transfer"
+	// PollsDelete removes the polls and every ballot cast on them.
+	PollsDelete PollDisposition = "delete"
+)
+
+// VoteDisposition says what happens to the ballots a deleted account cast
+// on other people's polls.
+type VoteDisposition string
+
+const (
+	// VotesAnonymize keeps the ballots, and so the tallies, but detaches
+	// them from the account.
+	VotesAnonymize VoteDisposition = "anonymize"
+	// VotesRemove deletes the ballots and takes them off the tallies.
+	VotesRemove VoteDisposition = "remove"
+)
+
+// DeleteOptions are the choices the user makes when deleting their account.
+type DeleteOptions struct {
+	Polls PollDisposition
+	// TransferTo receives the polls when Polls is PollsTransfer. It is nil
+	// when the address given does not belong to an account.
+	TransferTo *user.User
+	Votes      VoteDisposition
+}
+
+// validate checks the options u chose. The recipient of transferred polls
+// must be a different, fully registered account with a verified address.
+func (o DeleteOptions) validate(u *user.User) error {
+	if o.Votes != VotesAnonymize && o.Votes != VotesRemove {
+		return ErrInvalidVoteDisposition
+	}
+
+	switch o.Polls {
+	case PollsDelete:
+	case PollsTransfer:
+		switch {
+		case o.TransferTo == nil || o.TransferTo.Pending:
+			return ErrNoTransferTarget
+		case o.TransferTo.ID == u.ID:
+			return ErrTransferToSelf
+		case !o.TransferTo.EmailVerified:
+			return ErrTransferTargetUnverified
+		}
+	default:
+		return ErrInvalidPollDisposition
+	}
+	return nil
+}
+
+// DeleteResult reports what account deletion did.
+type DeleteResult struct {
+	PollsTransferred int64 `json:"polls_transferred"`
+	PollsDeleted     int   `json:"polls_deleted"`
+	VotesAnonymized  int64 `json:"votes_anonymized"`
+	VotesRemoved     int   `json:"votes_removed"`
+	SessionsEnded    int64 `json:"sessions_ended"`
+}
+
+// exportedPoll is a created poll in the export, with the ballots cast on it.
+// Voters are left out: they are other people's data.
+type exportedPoll struct {
+	poll.Poll
+	Votes []exportedBallot `json:"votes"`
+}
+
+type exportedBallot struct {
+	OptionIDs []primitive.ObjectID `json:"option_ids"`
+	VotedAt   time.Time            `json:"voted_at"`
+}
@@ -0,0 +1,281 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/poll"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/vote"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidPollDisposition   = errors.New(`polls must be "transfer" or "delete"`)
+	ErrInvalidVoteDisposition   = errors.New(`votes must be "anonymize" or "remove"`)
+	ErrNoTransferTarget         = errors.New("transfer_to does not name an existing account")
+	ErrTransferToSelf           = errors.New("Cannot transfer polls to the account being deleted")
+	ErrTransferTargetUnverified = errors.New("transfer_to must have a verified email address")
+)
+
+// NotMemberError rejects a transfer to an account that is not a member of
+// every workspace the polls are in. Polls are only handed to someone who can
+// already see them, never used to add them to a workspace.
+type NotMemberError struct {
+	Workspaces []string
+}
+
+func (e *NotMemberError) Error() string {
+	return "transfer_to is not a member of every workspace the polls are in: " + strings.Join(e.Workspaces, ", ")
+}
+
+// The parts of the other services AccountService uses.
+type (
+	userStore interface {
+		DeleteUser(ctx context.Context, userID primitive.ObjectID) error
+	}
+	pollStore interface {
+		ListPollsByCreator(ctx context.Context, userID primitive.ObjectID) ([]poll.Poll, error)
+		TransferPolls(ctx context.Context, from, to primitive.ObjectID) (int64, error)
+		DeletePoll(ctx context.Context, p *poll.Poll) error
+		RetractVotes(ctx context.Context, userID primitive.ObjectID) (int, error)
+	}
+	voteStore interface {
+		GetVotesForPoll(ctx context.Context, pollID primitive.ObjectID) ([]vote.Vote, error)
+		GetVotesByUser(ctx context.Context, userID primitive.ObjectID) ([]vote.Vote, error)
+		AnonymizeVotesByUser(ctx context.Context, userID primitive.ObjectID) (int64, error)
+	}
+	sessionStore interface {
+		ListSessions(ctx context.Context, userID primitive.ObjectID) ([]session.Session, error)
+		RevokeAllSessions(ctx context.Context, userID primitive.ObjectID, keep ...primitive.ObjectID) (int64, error)
+	}
+	workspaceStore interface {
+		ListForUser(ctx context.Context, userID primitive.ObjectID) ([]workspace.Membership, error)
+		RemoveUser(ctx context.Context, userID primitive.ObjectID) error
+	}
+)
+
+// AccountService works on everything tied to a user across the users,
+// polls, votes, sessions and workspace collections.
+type AccountService struct {
+	userService      userStore
+	pollService      pollStore
+	voteService      voteStore
+	sessionService   sessionStore
+	workspaceService workspaceStore
+}
+
+func NewAccountService(userService *user.UserService, pollService *poll.PollService, voteService *vote.VoteService, sessionService *session.SessionService, workspaceService *workspace.WorkspaceService) *AccountService {
+	return &AccountService{
+		userService:      userService,
+		pollService:      pollService,
+		voteService:      voteService,
+		sessionService:   sessionService,
+		workspaceService: workspaceService,
+	}
+}
+
+// Export writes a zip archive of the user's data to w: their profile,
+// credential and token metadata, sessions, workspaces, the polls they
+// created with the ballots cast on them, and the ballots they cast
+// themselves.
+func (s *AccountService) Export(ctx context.Context, u *user.User, w io.Writer) error {
+	credentials := make([]user.CredentialView, len(u.Credentials))
+	for i := range u.Credentials {
+		credentials[i] = user.NewCredentialView(&u.Credentials[i])
+	}
+
+	tokens := u.AccessTokens
+	if tokens == nil {
+		tokens = []user.AccessToken{}
+	}
+
+	sessions, err := s.sessionService.ListSessions(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	sessionViews := make([]session.View, len(sessions))
+	for i := range sessions {
+		sessionViews[i] = session.NewView(&sessions[i], primitive.NilObjectID)
+	}
+
+	memberships, err := s.workspaceService.ListForUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	created, err := s.pollService.ListPollsByCreator(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	polls := make([]exportedPoll, len(created))
+	for i, p := range created {
+		votes, err := s.voteService.GetVotesForPoll(ctx, p.ID)
+		if err != nil {
+			return err
+		}
+		ballots := make([]exportedBallot, len(votes))
+		for j, v := range votes {
+			ballots[j] = exportedBallot{OptionIDs: v.OptionIDs, VotedAt: v.VotedAt}
+		}
+		polls[i] = exportedPoll{Poll: p, Votes: ballots}
+	}
+
+	cast, err := s.voteService.GetVotesByUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user.NewProfile(u)},
+		{"credentials.json", credentials},
+		{"access_tokens.json", tokens},
+		{"sessions.json", sessionViews},
+		{"workspaces.json", memberships},
+		{"polls.json", polls},
+		{"votes.json", cast},
+	}
+	for _, f := range files {
+		if err := writeJSON(archive, f.name, f.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, data interface{}) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// Delete removes the user's account. Their polls are transferred or deleted
+// and their other ballots anonymized or removed, as opts says, so tallies
+// stay consistent either way. Invalid options are rejected before anything
+// is changed. The account document goes last, so a failed deletion can
+// simply be retried.
+func (s *AccountService) Delete(ctx context.Context, u *user.User, opts DeleteOptions) (*DeleteResult, error) {
+	if err := opts.validate(u); err != nil {
+		return nil, err
+	}
+	result := &DeleteResult{}
+
+	switch opts.Polls {
+	case PollsTransfer:
+		polls, err := s.pollService.ListPollsByCreator(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkTransfer(ctx, u, opts.TransferTo, polls); err != nil {
+			return nil, err
+		}
+		n, err := s.pollService.TransferPolls(ctx, u.ID, opts.TransferTo.ID)
+		if err != nil {
+			return nil, err
+		}
+		result.PollsTransferred = n
+	case PollsDelete:
+		polls, err := s.pollService.ListPollsByCreator(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range polls {
+			if err := s.pollService.DeletePoll(ctx, &polls[i]); err != nil {
+				return nil, err
+			}
+		}
+		result.PollsDeleted = len(polls)
+	}
+
+	switch opts.Votes {
+	case VotesRemove:
+		n, err := s.pollService.RetractVotes(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		result.VotesRemoved = n
+	default:
+		n, err := s.voteService.AnonymizeVotesByUser(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		result.VotesAnonymized = n
+	}
+
+	n, err := s.sessionService.RevokeAllSessions(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	result.SessionsEnded = n
+
+	if err := s.workspaceService.RemoveUser(ctx, u.ID); err != nil {
+		return nil, err
+	}
+	if err := s.userService.DeleteUser(ctx, u.ID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkTransfer makes sure target is a member of every workspace polls are
+// in.
+func (s *AccountService) checkTransfer(ctx context.Context, u, target *user.User, polls []poll.Poll) error {
+	memberships, err := s.workspaceService.ListForUser(ctx, target.ID)
+	if err != nil {
+		return err
+	}
+	missing := missingWorkspaces(polls, memberships)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// Name them from the deleting user's side, who is a member of them all
+	own, err := s.workspaceService.ListForUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	names := make(map[primitive.ObjectID]string, len(own))
+	for _, m := range own {
+		names[m.ID] = m.Name
+	}
+	e := &NotMemberError{}
+	for _, id := range missing {
+		name, ok := names[id]
+		if !ok {
+			name = id.Hex()
+		}
+		e.Workspaces = append(e.Workspaces, name)
+	}
+	return e
+}
+
+// missingWorkspaces returns the workspaces polls are in that memberships
+// does not cover, each once, in the order the polls list them.
+func missingWorkspaces(polls []poll.Poll, memberships []workspace.Membership) []primitive.ObjectID {
+	member := make(map[primitive.ObjectID]bool, len(memberships))
+	for _, m := range memberships {
+		member[m.ID] = true
+	}
+	var missing []primitive.ObjectID
+	for _, p := range polls {
+		if !member[p.WorkspaceID] {
+			member[p.WorkspaceID] = true
+			missing = append(missing, p.WorkspaceID)
+		}
+	}
+	return missing
+}
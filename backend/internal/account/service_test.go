@@ -0,0 +1,178 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/poll"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/vote"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// stores fakes every service AccountService uses and records the calls that
+// change something, in order.
+type stores struct {
+	polls       []poll.Poll
+	memberships map[primitive.ObjectID][]workspace.Membership
+	retracted   int
+	anonymized  int64
+	calls       []string
+}
+
+func (s *stores) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	s.calls = append(s.calls, "DeleteUser")
+	return nil
+}
+
+func (s *stores) ListPollsByCreator(ctx context.Context, userID primitive.ObjectID) ([]poll.Poll, error) {
+	return s.polls, nil
+}
+
+func (s *stores) TransferPolls(ctx context.Context, from, to primitive.ObjectID) (int64, error) {
+	s.calls = append(s.calls, "TransferPolls")
+	return int64(len(s.polls)), nil
+}
+
+func (s *stores) DeletePoll(ctx context.Context, p *poll.Poll) error {
+	s.calls = append(s.calls, "DeletePoll")
+	return nil
+}
+
+func (s *stores) RetractVotes(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	s.calls = append(s.calls, "RetractVotes")
+	return s.retracted, nil
+}
+
+func (s *stores) GetVotesForPoll(ctx context.Context, pollID primitive.ObjectID) ([]vote.Vote, error) {
+	return nil, nil
+}
+
+func (s *stores) GetVotesByUser(ctx context.Context, userID primitive.ObjectID) ([]vote.Vote, error) {
+	return nil, nil
+}
+
+func (s *stores) AnonymizeVotesByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	s.calls = append(s.calls, "AnonymizeVotesByUser")
+	return s.anonymized, nil
+}
+
+func (s *stores) ListSessions(ctx context.Context, userID primitive.ObjectID) ([]session.Session, error) {
+	return nil, nil
+}
+
+func (s *stores) RevokeAllSessions(ctx context.Context, userID primitive.ObjectID, keep ...primitive.ObjectID) (int64, error) {
+	s.calls = append(s.calls, "RevokeAllSessions")
+	return 1, nil
+}
+
+func (s *stores) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]workspace.Membership, error) {
+	return s.memberships[userID], nil
+}
+
+func (s *stores) RemoveUser(ctx context.Context, userID primitive.ObjectID) error {
+	s.calls = append(s.calls, "RemoveUser")
+	return nil
+}
+
+func newTestService(s *stores) *AccountService {
+	return &AccountService{userService: s, pollService: s, voteService: s, sessionService: s, workspaceService: s}
+}
+
+func TestDeleteOptionsValidate(t *testing.T) {
+	caller := &user.User{ID: primitive.NewObjectID(), EmailVerified: true}
+	verified := &user.User{ID: primitive.NewObjectID(), EmailVerified: true}
+	unverified := &user.User{ID: primitive.NewObjectID()}
+	pending := &user.User{ID: primitive.NewObjectID(), Pending: true, EmailVerified: true}
+
+	cases := map[string]struct {
+		opts DeleteOptions
+		want error
+	}{
+		"delete":              {DeleteOptions{Polls: PollsDelete, Votes: VotesAnonymize}, nil},
+		"transfer":            {DeleteOptions{Polls: PollsTransfer, TransferTo: verified, Votes: VotesRemove}, nil},
+		"no poll choice":      {DeleteOptions{Votes: VotesAnonymize}, ErrInvalidPollDisposition},
+		"unknown poll choice": {DeleteOptions{Polls: "archive", Votes: VotesAnonymize}, ErrInvalidPollDisposition},
+		"unknown vote choice": {DeleteOptions{Polls: PollsDelete, Votes: "keep"}, ErrInvalidVoteDisposition},
+		"no such account":     {DeleteOptions{Polls: PollsTransfer, Votes: VotesAnonymize}, ErrNoTransferTarget},
+		"pending account":     {DeleteOptions{Polls: PollsTransfer, TransferTo: pending, Votes: VotesAnonymize}, ErrNoTransferTarget},
+		"to self":             {DeleteOptions{Polls: PollsTransfer, TransferTo: caller, Votes: VotesAnonymize}, ErrTransferToSelf},
+		"unverified account":  {DeleteOptions{Polls: PollsTransfer, TransferTo: unverified, Votes: VotesAnonymize}, ErrTransferTargetUnverified},
+	}
+	for name, c := range cases {
+		if err := c.opts.validate(caller); err != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, err)
+		}
+	}
+}
+
+func TestDeleteTransferRequiresMembership(t *testing.T) {
+	caller := &user.User{ID: primitive.NewObjectID()}
+	target := &user.User{ID: primitive.NewObjectID(), EmailVerified: true}
+	team := workspace.Workspace{ID: primitive.NewObjectID(), Name: "Team"}
+	club := workspace.Workspace{ID: primitive.NewObjectID(), Name: "Club"}
+
+	s := &stores{
+		polls: []poll.Poll{{WorkspaceID: team.ID}, {WorkspaceID: club.ID}, {WorkspaceID: club.ID}},
+		memberships: map[primitive.ObjectID][]workspace.Membership{
+			caller.ID: {{Workspace: team}, {Workspace: club}},
+			target.ID: {{Workspace: team}},
+		},
+	}
+	_, err := newTestService(s).Delete(context.Background(), caller, DeleteOptions{Polls: PollsTransfer, TransferTo: target, Votes: VotesAnonymize})
+
+	var notMember *NotMemberError
+	if !errors.As(err, &notMember) {
+		t.Fatalf("expected a NotMemberError; got %v", err)
+	}
+	if !reflect.DeepEqual(notMember.Workspaces, []string{"Club"}) {
+		t.Errorf("expected only Club to be named; got %v", notMember.Workspaces)
+	}
+	if len(s.calls) != 0 {
+		t.Errorf("expected nothing to change; got %v", s.calls)
+	}
+
+	s.memberships[target.ID] = append(s.memberships[target.ID], workspace.Membership{Workspace: club})
+	result, err := newTestService(s).Delete(context.Background(), caller, DeleteOptions{Polls: PollsTransfer, TransferTo: target, Votes: VotesAnonymize})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if result.PollsTransferred != 3 {
+		t.Errorf("expected 3 polls transferred; got %d", result.PollsTransferred)
+	}
+}
+
+func TestDeleteTallies(t *testing.T) {
+	caller := &user.User{ID: primitive.NewObjectID()}
+
+	cases := map[VoteDisposition]struct {
+		calls  []string
+		result DeleteResult
+	}{
+		VotesRemove: {
+			[]string{"DeletePoll", "RetractVotes", "RevokeAllSessions", "RemoveUser", "DeleteUser"},
+			DeleteResult{PollsDeleted: 1, VotesRemoved: 4, SessionsEnded: 1},
+		},
+		VotesAnonymize: {
+			[]string{"DeletePoll", "AnonymizeVotesByUser", "RevokeAllSessions", "RemoveUser", "DeleteUser"},
+			DeleteResult{PollsDeleted: 1, VotesAnonymized: 5, SessionsEnded: 1},
+		},
+	}
+	for votes, c := range cases {
+		s := &stores{polls: []poll.Poll{{}}, retracted: 4, anonymized: 5}
+		result, err := newTestService(s).Delete(context.Background(), caller, DeleteOptions{Polls: PollsDelete, Votes: votes})
+		if err != nil {
+			t.Fatalf("%s: Delete: %v", votes, err)
+		}
+		if !reflect.DeepEqual(s.calls, c.calls) {
+			t.Errorf("%s: expected calls %v; got %v", votes, c.calls, s.calls)
+		}
+		if *result != c.result {
+			t.Errorf("%s: expected %+v; got %+v", votes, c.result, *result)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/poll"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type AdminHandler struct {
+	userService *user.UserService
+	pollService *poll.PollService
+	auditLog    *audit.AuditService
+	attestation *user.AttestationPolicy
+}
+
+func NewAdminHandler(userService *user.UserService, pollService *poll.PollService, auditLog *audit.AuditService, attestation *user.AttestationPolicy) *AdminHandler {
+	return &AdminHandler{
+		userService: userService,
+		pollService: pollService,
+		auditLog:    auditLog,
+		attestation: attestation,
+	}
+}
+
+// UserSummary is the admin view of an account, without key material.
+type UserSummary struct {
+	ID            primitive.ObjectID `json:"id"`
+	Name          string             `json:"name"`
+	DisplayName   string             `json:"display_name"`
+	Email         string             `json:"email"`
+	EmailVerified bool               `json:"email_verified"`
+	Role          user.Role          `json:"role"`
+	Pending       bool               `json:"pending"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Credentials   int                `json:"credentials"`
+	CreatedPolls  int                `json:"created_polls"`
+}
+
+func newUserSummary(u *user.User) UserSummary {
+	return UserSummary{
+		ID:            u.ID,
+		Name:          u.Name,
+		DisplayName:   u.DisplayName,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Role:          u.EffectiveRole(),
+		Pending:       u.Pending,
+		CreatedAt:     u.CreatedAt,
+		Credentials:   len(u.Credentials),
+		CreatedPolls:  len(u.CreatedPolls),
+	}
+}
+
+type page struct {
+	Items  interface{} `json:"items"`
+	Total  int64       `json:"total"`
+	Offset int64       `json:"offset"`
+	Limit  int64       `json:"limit"`
+}
+
+// parsePage reads the offset and limit query parameters.
+func parsePage(r *http.Request) (int64, int64) {
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	return offset, min(limit, maxPageSize)
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	offset, limit := parsePage(r)
+
+	users, total, err := h.userService.ListUsers(r.Context(), offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]UserSummary, len(users))
+	for i := range users {
+		summaries[i] = newUserSummary(&users[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page{Items: summaries, Total: total, Offset: offset, Limit: limit})
+}
+
+func (h *AdminHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.userService.GetUser(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserSummary(u))
+}
+
+func (h *AdminHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	caller, ok := user.FromContext(r.Context())
+	if !ok || !caller.Can(user.PermManageRoles) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always one left
+	if userID == caller.ID {
+		http.Error(w, "Cannot change your own role", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Role user.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// Someone whose passkeys the role's attestation policy rejects could
+	// no longer sign in
+	target, err := h.userService.GetUser(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if !h.attestation.Satisfied(target, req.Role) {
+		http.Error(w, "User has no passkey that meets the attestation policy for this role", http.StatusConflict)
+		return
+	}
+
+	if err := h.userService.SetRole(userID, req.Role); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionRoleChange, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetUser, userID.Hex()).
+		With("role", string(req.Role)))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) ListPolls(w http.ResponseWriter, r *http.Request) {
+	offset, limit := parsePage(r)
+
+	polls, total, err := h.pollService.ListPolls(r.Context(), offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page{Items: polls, Total: total, Offset: offset, Limit: limit})
+}
+
+// ListAuditEvents pages through the audit log, newest first. Every query
+// parameter other than offset and limit narrows the results.
+func (h *AdminHandler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	offset, limit := parsePage(r)
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, total, err := h.auditLog.List(r.Context(), filter, offset, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page{Items: events, Total: total, Offset: offset, Limit: limit})
+}
+
+func parseAuditFilter(r *http.Request) (audit.Filter, error) {
+	q := r.URL.Query()
+	filter := audit.Filter{
+		ActorEmail: q.Get("actor_email"),
+		TargetType: audit.TargetType(q.Get("target_type")),
+		TargetID:   q.Get("target_id"),
+		Action:     audit.Action(q.Get("action")),
+		Outcome:    audit.Outcome(q.Get("outcome")),
+		IP:         q.Get("ip"),
+	}
+
+	if v := q.Get("actor_id"); v != "" {
+		actorID, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid actor_id")
+		}
+		filter.ActorID = &actorID
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid since: use RFC 3339")
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("invalid until: use RFC 3339")
+		}
+	}
+	return filter, nil
+}
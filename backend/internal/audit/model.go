@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Action string
+
+const (
+	ActionRegister           Action = "user.register"
+	ActionLogin              Action = "user.login"
+	ActionEmailVerify        Action = "user.email_verify"
+	ActionEmailChangeRequest Action = "user.email_change_request"
+	ActionEmailChange        Action = "user.email_change"
+	ActionProfileUpdate      Action = "user.profile_update"
+	ActionAccountExport      Action = "user.export"
+	ActionAccountDelete      Action = "user.delete"
+	ActionRoleChange         Action = "user.role_change"
+	ActionLogout             Action = "session.logout"
+	ActionReauthenticate     Action = "session.reauthenticate"
+	ActionSessionRevoke      Action = "session.revoke"
+	ActionCredentialAdd      Action = "credential.add"
+	ActionCredentialRename   Action = "credential.rename"
+	ActionCredentialRevoke   Action = "credential.revoke"
+	ActionCloneWarning       Action = "credential.clone_warning"
+	ActionRecoveryRegenerate Action = "recovery.regenerate"
+	ActionRecoveryRedeem     Action = "recovery.redeem"
+	ActionTokenCreate        Action = "token.create"
+	ActionTokenRevoke        Action = "token.revoke"
+	ActionPollCreate         Action = "poll.create"
+	ActionVote               Action = "poll.vote"
+	ActionPollClose          Action = "poll.close"
+	ActionPollReopen         Action = "poll.reopen"
+	ActionPollEdit           Action = "poll.edit"
+	ActionPollDelete         Action = "poll.delete"
+	ActionPollRestore        Action = "poll.restore"
+	ActionPollVisibility     Action = "poll.visibility"
+	ActionWorkspaceCreate    Action = "workspace.create"
+	ActionWorkspaceInvite    Action = "workspace.invite"
+	ActionInvitationRevoke   Action = "workspace.invite_revoke"
+	ActionWorkspaceJoin      Action = "workspace.join"
+	ActionMemberRemove       Action = "workspace.member_remove"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+type TargetType string
+
+const (
+	TargetUser        TargetType = "user"
+	TargetCredential  TargetType = "credential"
+	TargetSession     TargetType = "session"
+	TargetAccessToken TargetType = "access_token"
+	TargetPoll        TargetType = "poll"
+	TargetWorkspace   TargetType = "workspace"
+)
+
+// Actor is who did something. Failed logins may only know the email that
+// was tried.
+type Actor struct {
+	UserID *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Email  string              `bson:"email,omitempty" json:"email,omitempty"`
+}
+
+// Target is what an action was done to.
+type Target struct {
+	Type TargetType `bson:"type" json:"type"`
+	ID   string     `bson:"id" json:"id"`
+}
+
+// Event is one entry in the audit log. Events are only ever inserted.
+type Event struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Time      time.Time          `bson:"time" json:"time"`
+	Action    Action             `bson:"action" json:"action"`
+	Outcome   Outcome            `bson:"outcome" json:"outcome"`
+	Actor     Actor              `bson:"actor" json:"actor"`
+	Target    *Target            `bson:"target,omitempty" json:"target,omitempty"`
+	IP        string             `bson:"ip" json:"ip"`
+	UserAgent string             `bson:"user_agent" json:"user_agent"`
+	// Reason says why an action failed, in a word or two.
+	Reason  string            `bson:"reason,omitempty" json:"reason,omitempty"`
+	Details map[string]string `bson:"details,omitempty" json:"details,omitempty"`
+}
+
+// NewEvent starts an event for an action taken by the client behind r.
+func NewEvent(r *http.Request, action Action, outcome Outcome) Event {
+	return Event{
+		Time:      time.Now(),
+		Action:    action,
+		Outcome:   outcome,
+		IP:        session.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// By sets the actor to a known user.
+func (e Event) By(userID primitive.ObjectID, email string) Event {
+	e.Actor = Actor{UserID: &userID, Email: email}
+	return e
+}
+
+// ByEmail sets the actor to whoever claimed to be email, for attempts that
+// never got as far as an account.
+func (e Event) ByEmail(email string) Event {
+	e.Actor = Actor{Email: email}
+	return e
+}
+
+func (e Event) On(targetType TargetType, id string) Event {
+	e.Target = &Target{Type: targetType, ID: id}
+	return e
+}
+
+func (e Event) Because(reason string) Event {
+	e.Reason = reason
+	return e
+}
+
+func (e Event) With(key, value string) Event {
+	details := make(map[string]string, len(e.Details)+1)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details[key] = value
+	e.Details = details
+	return e
+}
+
+// Filter narrows a query of the audit log. Zero fields match everything.
+type Filter struct {
+	ActorID    *primitive.ObjectID
+	ActorEmail string
+	TargetType TargetType
+	TargetID   string
+	Action     Action
+	Outcome    Outcome
+	IP         string
+	Since      time.Time
+	Until      time.Time
+}
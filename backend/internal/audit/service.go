@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditService appends to and queries the audit_events collection. It has
+// no way to change or remove an event once written.
+type AuditService struct {
+	collection *mongo.Collection
+}
+
+func NewAuditService(db *mongo.Database) *AuditService {
+	return &AuditService{
+		collection: db.Collection("audit_events"),
+	}
+}
+
+func (s *AuditService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor.user_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "target.id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+	})
+	return err
+}
+
+// Record appends e to the log. A failed write is logged rather than
+// returned, so auditing never turns a completed action into an error.
+func (s *AuditService) Record(ctx context.Context, e Event) {
+	if _, err := s.collection.InsertOne(ctx, e); err != nil {
+		log.Printf("Error writing audit event %s: %v", e.Action, err)
+	}
+}
+
+// List returns events matching f, newest first, along with the total number
+// of matches.
+func (s *AuditService) List(ctx context.Context, f Filter, skip, limit int64) ([]Event, int64, error) {
+	filter := f.query()
+
+	total, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []Event{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+func (f Filter) query() bson.M {
+	q := bson.M{}
+	if f.ActorID != nil {
+		q["actor.user_id"] = *f.ActorID
+	}
+	if f.ActorEmail != "" {
+		q["actor.email"] = f.ActorEmail
+	}
+	if f.TargetType != "" {
+		q["target.type"] = f.TargetType
+	}
+	if f.TargetID != "" {
+		q["target.id"] = f.TargetID
+	}
+	if f.Action != "" {
+		q["action"] = f.Action
+	}
+	if f.Outcome != "" {
+		q["outcome"] = f.Outcome
+	}
+	if f.IP != "" {
+		q["ip"] = f.IP
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		t := bson.M{}
+		if !f.Since.IsZero() {
+			t["$gte"] = f.Since
+		}
+		if !f.Until.IsZero() {
+			t["$lt"] = f.Until
+		}
+		q["time"] = t
+	}
+	return q
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFilterQuery(t *testing.T) {
+	userID := primitive.NewObjectID()
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name   string
+		filter Filter
+		want   bson.M
+	}{
+		{"empty", Filter{}, bson.M{}},
+		{
+			"actor and outcome",
+			Filter{ActorID: &userID, Outcome: OutcomeFailure},
+			bson.M{"actor.user_id": userID, "outcome": OutcomeFailure},
+		},
+		{
+			"target and since",
+			Filter{TargetType: TargetPoll, TargetID: "abc", Since: since},
+			bson.M{"target.type": TargetPoll, "target.id": "abc", "time": bson.M{"$gte": since}},
+		},
+	}
+	for _, c := range cases {
+		if got := c.filter.query(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %v; got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestEventWithCopiesDetails(t *testing.T) {
+	base := Event{}.With("a", "1")
+	derived := base.With("b", "2")
+
+	if len(base.Details) != 1 {
+		t.Errorf("expected base to keep 1 detail; got %v", base.Details)
+	}
+	if len(derived.Details) != 2 {
+		t.Errorf("expected derived to have 2 details; got %v", derived.Details)
+	}
+}
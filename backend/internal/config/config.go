@@ -0,0 +1,470 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// Config is the backend configuration. It is read from the JSON file named by
+// CONFIG_FILE, if any, and then overridden by environment variables.
+type Config struct {
+	Port int `json:"port"`
+	// AppURL is the frontend base URL used to build links in emails.
+	AppURL   string         `json:"app_url"`
+	WebAuthn WebAuthnConfig `json:"webauthn"`
+	Session  SessionConfig  `json:"session"`
+	Mail     MailConfig     `json:"mail"`
+	// PendingRegistrationTTL is how long a registration may stay without a
+	// passkey before it is deleted and the email becomes free again.
+	PendingRegistrationTTL Duration `json:"pending_registration_ttl"`
+	// PollRestoreWindow is how long a deleted poll can be restored before
+	// it and its votes are purged for good.
+	PollRestoreWindow Duration `json:"poll_restore_window"`
+	// BootstrapAdminEmail is promoted to admin, once verified, while no
+	// admin exists yet.
+	BootstrapAdminEmail string `json:"bootstrap_admin_email"`
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header names the client.
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+type WebAuthnConfig struct {
+	RPID          string `json:"rp_id"`
+	RPDisplayName string `json:"rp_display_name"`
+	// RPOrigins lists every origin allowed to run ceremonies, so staging
+	// and production frontends can share one backend and RP ID.
+	RPOrigins           []string `json:"rp_origins"`
+	Attestation         string   `json:"attestation"`
+	UserVerification    string   `json:"user_verification"`
+	LoginTimeout        Duration `json:"login_timeout"`
+	RegistrationTimeout Duration `json:"registration_timeout"`
+	// ClonePolicy is "reject" or "flag", see user.ClonePolicy.
+	ClonePolicy       string                  `json:"clone_policy"`
+	AttestationPolicy AttestationPolicyConfig `json:"attestation_policy"`
+}
+
+// AttestationPolicyConfig restricts which authenticator models may register
+// passkeys, see user.AttestationPolicy.
+type AttestationPolicyConfig struct {
+	// MDSFile is a FIDO Metadata Service blob downloaded ahead of time, so
+	// attestation can be checked without network access.
+	MDSFile      string   `json:"mds_file"`
+	AllowAAGUIDs []string `json:"allow_aaguids"`
+	DenyAAGUIDs  []string `json:"deny_aaguids"`
+	// Roles adds requirements per role, such as hardware keys for admins.
+	Roles map[string]RoleAttestationConfig `json:"roles"`
+}
+
+type RoleAttestationConfig struct {
+	RequireAttestation bool     `json:"require_attestation"`
+	AllowAAGUIDs       []string `json:"allow_aaguids"`
+}
+
+type SessionConfig struct {
+	Secret string   `json:"secret"`
+	TTL    Duration `json:"ttl"`
+	// FreshAuthTTL is how long a login or step-up re-authentication counts
+	// as proof that the user is present, for sensitive actions.
+	FreshAuthTTL Duration `json:"fresh_auth_ttl"`
+	// CeremonyStore is "mongo" or "memory".
+	CeremonyStore string `json:"ceremony_store"`
+	// CookieSecure marks the session cookie Secure. Left unset, it is on
+	// when app_url or any of the rp_origins is https.
+	CookieSecure *bool `json:"cookie_secure"`
+}
+
+type MailConfig struct {
+	// Driver is "log" for local development or "smtp".
+	Driver       string `json:"driver"`
+	From         string `json:"from"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     int    `json:"smtp_port"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+	// OutboxDir makes the log driver write messages to files instead.
+	OutboxDir       string   `json:"outbox_dir"`
+	VerificationTTL Duration `json:"verification_ttl"`
+}
+
+// Duration reads as a time.ParseDuration string such as "5m" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func defaults() *Config {
+	return &Config{
+		Port: 8080,
+		WebAuthn: WebAuthnConfig{
+			RPID:                "localhost",
+			RPDisplayName:       "Polling App",
+			RPOrigins:           []string{"http://localhost:3000"},
+			Attestation:         string(protocol.PreferNoAttestation),
+			UserVerification:    string(protocol.VerificationPreferred),
+			LoginTimeout:        Duration{time.Minute},
+			RegistrationTimeout: Duration{5 * time.Minute},
+			ClonePolicy:         "reject",
+		},
+		Session: SessionConfig{
+			TTL:           Duration{24 * time.Hour},
+			FreshAuthTTL:  Duration{5 * time.Minute},
+			CeremonyStore: "mongo",
+		},
+		Mail: MailConfig{
+			Driver:          "log",
+			From:            "no-reply@localhost",
+			SMTPPort:        587,
+			VerificationTTL: Duration{24 * time.Hour},
+		},
+		PendingRegistrationTTL: Duration{time.Hour},
+		PollRestoreWindow:      Duration{30 * 24 * time.Hour},
+	}
+}
+
+// Load builds the configuration and validates it.
+func Load() (*Config, error) {
+	cfg := defaults()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %v", err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %v", err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if cfg.AppURL == "" && len(cfg.WebAuthn.RPOrigins) > 0 {
+		cfg.AppURL = cfg.WebAuthn.RPOrigins[0]
+	}
+	if cfg.Session.CookieSecure == nil {
+		secure := cfg.servedOverHTTPS()
+		cfg.Session.CookieSecure = &secure
+	}
+
+	if cfg.Session.Secret == "" {
+		log.Println("SESSION_SECRET is not set, using a random key")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate session secret: %v", err)
+		}
+		cfg.Session.Secret = string(secret)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid PORT: %v", err)
+		}
+		c.Port = port
+	}
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP_PORT: %v", err)
+		}
+		c.Mail.SMTPPort = port
+	}
+
+	if v := os.Getenv("COOKIE_SECURE"); v != "" {
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid COOKIE_SECURE: %v", err)
+		}
+		c.Session.CookieSecure = &secure
+	}
+
+	setString(&c.AppURL, "APP_URL")
+	setString(&c.BootstrapAdminEmail, "BOOTSTRAP_ADMIN_EMAIL")
+	setList(&c.TrustedProxies, "TRUSTED_PROXIES")
+
+	setString(&c.WebAuthn.RPID, "RP_ID")
+	setString(&c.WebAuthn.RPDisplayName, "RP_DISPLAY_NAME")
+	setList(&c.WebAuthn.RPOrigins, "RP_ORIGINS")
+	setString(&c.WebAuthn.Attestation, "WEBAUTHN_ATTESTATION")
+	setString(&c.WebAuthn.UserVerification, "WEBAUTHN_USER_VERIFICATION")
+	setString(&c.WebAuthn.ClonePolicy, "CLONE_WARNING_POLICY")
+	setString(&c.WebAuthn.AttestationPolicy.MDSFile, "MDS_FILE")
+	setList(&c.WebAuthn.AttestationPolicy.AllowAAGUIDs, "ATTESTATION_ALLOW_AAGUIDS")
+	setList(&c.WebAuthn.AttestationPolicy.DenyAAGUIDs, "ATTESTATION_DENY_AAGUIDS")
+	setString(&c.Session.Secret, "SESSION_SECRET")
+	setString(&c.Session.CeremonyStore, "CEREMONY_STORE")
+	setString(&c.Mail.Driver, "MAIL_DRIVER")
+	setString(&c.Mail.From, "MAIL_FROM")
+	setString(&c.Mail.SMTPHost, "SMTP_HOST")
+	setString(&c.Mail.SMTPUsername, "SMTP_USERNAME")
+	setString(&c.Mail.SMTPPassword, "SMTP_PASSWORD")
+	setString(&c.Mail.OutboxDir, "MAIL_OUTBOX_DIR")
+
+	durations := map[string]*Duration{
+		"WEBAUTHN_LOGIN_TIMEOUT":        &c.WebAuthn.LoginTimeout,
+		"WEBAUTHN_REGISTRATION_TIMEOUT": &c.WebAuthn.RegistrationTimeout,
+		"SESSION_TTL":                   &c.Session.TTL,
+		"FRESH_AUTH_TTL":                &c.Session.FreshAuthTTL,
+		"EMAIL_VERIFICATION_TTL":        &c.Mail.VerificationTTL,
+		"PENDING_REGISTRATION_TTL":      &c.PendingRegistrationTTL,
+		"POLL_RESTORE_WINDOW":           &c.PollRestoreWindow,
+	}
+	for name, d := range durations {
+		if v := os.Getenv(name); v != "" {
+			if err := d.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// servedOverHTTPS reports whether the frontend is reached over https, going
+// by app_url and rp_origins.
+func (c *Config) servedOverHTTPS() bool {
+	for _, origin := range append([]string{c.AppURL}, c.WebAuthn.RPOrigins...) {
+		if strings.HasPrefix(strings.ToLower(origin), "https://") {
+			return true
+		}
+	}
+	return false
+}
+
+func setString(dst *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v
+	}
+}
+
+// setList reads a comma separated environment variable.
+func setList(dst *[]string, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+// Validate reports every problem with the configuration at once, so a bad
+// deployment fails at startup rather than on the first passkey ceremony.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range", c.Port))
+	}
+
+	w := c.WebAuthn
+	if w.RPID == "" {
+		errs = append(errs, errors.New("webauthn rp_id is required"))
+	}
+	if w.RPDisplayName == "" {
+		errs = append(errs, errors.New("webauthn rp_display_name is required"))
+	}
+	if len(w.RPOrigins) == 0 {
+		errs = append(errs, errors.New("webauthn rp_origins needs at least one origin"))
+	}
+	for _, origin := range w.RPOrigins {
+		if err := validateOrigin(origin, w.RPID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch protocol.ConveyancePreference(w.Attestation) {
+	case protocol.PreferNoAttestation, protocol.PreferIndirectAttestation,
+		protocol.PreferDirectAttestation, protocol.PreferEnterpriseAttestation:
+	default:
+		errs = append(errs, fmt.Errorf("webauthn attestation %q is not one of none, indirect, direct, enterprise", w.Attestation))
+	}
+
+	switch protocol.UserVerificationRequirement(w.UserVerification) {
+	case protocol.VerificationRequired, protocol.VerificationPreferred, protocol.VerificationDiscouraged:
+	default:
+		errs = append(errs, fmt.Errorf("webauthn user_verification %q is not one of required, preferred, discouraged", w.UserVerification))
+	}
+
+	if w.LoginTimeout.Duration <= 0 || w.RegistrationTimeout.Duration <= 0 {
+		errs = append(errs, errors.New("webauthn timeouts must be positive"))
+	}
+
+	if w.ClonePolicy != "reject" && w.ClonePolicy != "flag" {
+		errs = append(errs, fmt.Errorf("clone_policy %q is not one of reject, flag", w.ClonePolicy))
+	}
+	errs = append(errs, w.AttestationPolicy.validate()...)
+
+	if c.Session.TTL.Duration <= 0 {
+		errs = append(errs, errors.New("session ttl must be positive"))
+	}
+	if c.Session.FreshAuthTTL.Duration <= 0 || c.Session.FreshAuthTTL.Duration > c.Session.TTL.Duration {
+		errs = append(errs, errors.New("session fresh_auth_ttl must be positive and no longer than ttl"))
+	}
+	if c.Session.CeremonyStore != "mongo" && c.Session.CeremonyStore != "memory" {
+		errs = append(errs, fmt.Errorf("ceremony_store %q is not one of mongo, memory", c.Session.CeremonyStore))
+	}
+
+	if _, err := url.ParseRequestURI(c.AppURL); err != nil {
+		errs = append(errs, fmt.Errorf("app_url %q is not a valid URL", c.AppURL))
+	}
+
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("mail smtp_host is required for the smtp driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail driver %q is not one of log, smtp", c.Mail.Driver))
+	}
+	if c.Mail.From == "" {
+		errs = append(errs, errors.New("mail from is required"))
+	}
+	if c.Mail.VerificationTTL.Duration <= 0 {
+		errs = append(errs, errors.New("mail verification_ttl must be positive"))
+	}
+	// Shorter than a registration ceremony would reap users mid-ceremony.
+	if c.PendingRegistrationTTL.Duration < c.WebAuthn.RegistrationTimeout.Duration {
+		errs = append(errs, errors.New("pending_registration_ttl must not be shorter than the registration timeout"))
+	}
+	if c.PollRestoreWindow.Duration <= 0 {
+		errs = append(errs, errors.New("poll_restore_window must be positive"))
+	}
+	if _, err := session.ParseTrustedProxies(c.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a AttestationPolicyConfig) validate() []error {
+	var errs []error
+
+	lists := map[string][]string{
+		"allow_aaguids": a.AllowAAGUIDs,
+		"deny_aaguids":  a.DenyAAGUIDs,
+	}
+	for role, req := range a.Roles {
+		switch role {
+		case "user", "moderator", "admin":
+		default:
+			errs = append(errs, fmt.Errorf("attestation_policy role %q is not one of user, moderator, admin", role))
+		}
+		if req.RequireAttestation && a.MDSFile == "" {
+			errs = append(errs, fmt.Errorf("attestation_policy role %q requires attestation, which needs mds_file", role))
+		}
+		lists[role+" allow_aaguids"] = req.AllowAAGUIDs
+	}
+	for name, list := range lists {
+		for _, aaguid := range list {
+			if _, err := uuid.Parse(aaguid); err != nil {
+				errs = append(errs, fmt.Errorf("attestation_policy %s: %q is not an AAGUID", name, aaguid))
+			}
+		}
+	}
+
+	if a.MDSFile != "" {
+		if _, err := os.Stat(a.MDSFile); err != nil {
+			errs = append(errs, fmt.Errorf("attestation_policy mds_file: %v", err))
+		}
+	}
+	return errs
+}
+
+// validateOrigin checks that origin is a bare scheme://host[:port] whose host
+// falls under the RP ID, as browsers require.
+func validateOrigin(origin, rpID string) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("origin %q is not a valid URL: %v", origin, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("origin %q must use http or https", origin)
+	}
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("origin %q must not have a path, query or fragment", origin)
+	}
+	host := u.Hostname()
+	if u.Scheme == "http" && host != "localhost" {
+		return fmt.Errorf("origin %q must use https outside localhost", origin)
+	}
+	if host != rpID && !strings.HasSuffix(host, "."+rpID) {
+		return fmt.Errorf("origin %q is not on rp_id %q", origin, rpID)
+	}
+	return nil
+}
+
+// AllowsOrigin reports whether origin is one of the configured RP origins.
+func (w WebAuthnConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range w.RPOrigins {
+		if strings.TrimSuffix(allowed, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// CeremonyTTL is how long begun ceremonies are kept: long enough for the
+// slower of the two ceremonies to time out in the browser.
+func (w WebAuthnConfig) CeremonyTTL() time.Duration {
+	return max(w.LoginTimeout.Duration, w.RegistrationTimeout.Duration)
+}
+
+// Options converts the settings into a go-webauthn configuration.
+func (w WebAuthnConfig) Options() *webauthn.Config {
+	return &webauthn.Config{
+		RPID:                  w.RPID,
+		RPDisplayName:         w.RPDisplayName,
+		RPOrigins:             w.RPOrigins,
+		AttestationPreference: protocol.ConveyancePreference(w.Attestation),
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			UserVerification: protocol.UserVerificationRequirement(w.UserVerification),
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login: webauthn.TimeoutConfig{
+				Enforce:    true,
+				Timeout:    w.LoginTimeout.Duration,
+				TimeoutUVD: w.LoginTimeout.Duration,
+			},
+			Registration: webauthn.TimeoutConfig{
+				Enforce:    true,
+				Timeout:    w.RegistrationTimeout.Duration,
+				TimeoutUVD: w.RegistrationTimeout.Duration,
+			},
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultsAreValid(t *testing.T) {
+	cfg := defaults()
+	cfg.AppURL = cfg.WebAuthn.RPOrigins[0]
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected defaults to validate; got %v", err)
+	}
+}
+
+func TestValidateOrigins(t *testing.T) {
+	cases := map[string]bool{
+		"https://example.com":         true,
+		"https://staging.example.com": true,
+		"http://localhost:3000":       false,
+		"http://example.com":          false,
+		"https://example.org":         false,
+		"https://evilexample.com":     false,
+		"https://example.com/app":     false,
+	}
+	for origin, ok := range cases {
+		err := validateOrigin(origin, "example.com")
+		if ok && err != nil {
+			t.Errorf("%s: expected valid; got %v", origin, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("%s: expected an error", origin)
+		}
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := defaults()
+	cfg.AppURL = cfg.WebAuthn.RPOrigins[0]
+	cfg.WebAuthn.Attestation = "sometimes"
+	cfg.WebAuthn.ClonePolicy = "ignore"
+	cfg.Session.FreshAuthTTL = Duration{48 * time.Hour}
+	cfg.WebAuthn.AttestationPolicy.Roles = map[string]RoleAttestationConfig{
+		"admin": {RequireAttestation: true, AllowAAGUIDs: []string{"yubikey"}},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"attestation", "clone_policy", "fresh_auth_ttl", "mds_file", "not an AAGUID"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s; got %v", want, err)
+		}
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("RP_ID", "example.com")
+	t.Setenv("RP_ORIGINS", "https://example.com, https://staging.example.com")
+	t.Setenv("SESSION_TTL", "2h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(cfg.WebAuthn.RPOrigins) != 2 || cfg.WebAuthn.RPOrigins[1] != "https://staging.example.com" {
+		t.Errorf("unexpected origins %v", cfg.WebAuthn.RPOrigins)
+	}
+	if cfg.Session.TTL.Hours() != 2 {
+		t.Errorf("expected a 2h session TTL; got %v", cfg.Session.TTL)
+	}
+}
+
+func TestCookieSecure(t *testing.T) {
+	cases := map[string]struct {
+		rpID, origins, appURL, secure string
+		want                          bool
+	}{
+		"local http":        {"localhost", "http://localhost:3000", "", "", false},
+		"https origins":     {"example.com", "https://example.com", "", "", true},
+		"https app url":     {"localhost", "http://localhost:3000", "https://polls.example.com", "", true},
+		"forced off":        {"example.com", "https://example.com", "", "false", false},
+		"forced on locally": {"localhost", "http://localhost:3000", "", "true", true},
+	}
+	for name, c := range cases {
+		t.Setenv("RP_ID", c.rpID)
+		t.Setenv("RP_ORIGINS", c.origins)
+		t.Setenv("APP_URL", c.appURL)
+		t.Setenv("COOKIE_SECURE", c.secure)
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("%s: Load returned error: %v", name, err)
+		}
+		if got := *cfg.Session.CookieSecure; got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogMailer is for local development. It writes each message to the log, or
+// to a file in dir when one is given, instead of delivering it.
+type LogMailer struct {
+	dir string
+}
+
+func NewLogMailer(dir string) *LogMailer {
+	return &LogMailer{dir: dir}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	text := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+
+	if m.dir == "" {
+		log.Printf("Mail not sent (log mailer):\n%s", text)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(text), 0o644)
+}
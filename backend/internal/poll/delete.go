@@ -0,0 +1,131 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrRestoreWindowClosed answers restoring a poll that was deleted too long
+// ago and is waiting to be purged.
+var ErrRestoreWindowClosed = errors.New("This poll was deleted too long ago to be restored")
+
+// ErrDeletedByModerator answers a creator restoring a poll a moderator took
+// down.
+var ErrDeletedByModerator = errors.New("This poll was deleted by a moderator and cannot be restored by its creator")
+
+// notDeleted matches polls that have not been deleted.
+var notDeleted = bson.M{"$exists": false}
+
+// Restorable reports whether a deleted poll can still be restored at now,
+// given how long deleted polls are kept.
+func (p *Poll) Restorable(now time.Time, window time.Duration) bool {
+	return p.DeletedAt != nil && p.DeletedAt.After(now.Add(-window))
+}
+
+// RestorableBy reports whether u may restore the deleted poll: its creator
+// may, unless a moderator deleted it.
+func (p *Poll) RestorableBy(u *user.User) bool {
+	if p.DeletedByModerator {
+		return u.Can(user.PermModeratePolls)
+	}
+	return p.CreatedBy == u.ID
+}
+
+// SoftDeletePoll marks a poll of the workspace as deleted, and as taken
+// down by a moderator if moderated is set. It disappears from every read
+// but keeps its votes until PurgeDeletedPolls removes it.
+func (s *PollService) SoftDeletePoll(ctx context.Context, workspaceID, pollID primitive.ObjectID, moderated bool) (*Poll, error) {
+	set := bson.M{"deleted_at": time.Now()}
+	if moderated {
+		set["deleted_by_moderator"] = true
+	}
+
+	var poll Poll
+	err := s.pollCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": pollID, "workspace_id": workspaceID, "deleted_at": notDeleted},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&poll)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// GetDeletedPoll returns a deleted poll of the workspace that has not been
+// purged yet. Whether it can still be restored is up to Restorable.
+func (s *PollService) GetDeletedPoll(ctx context.Context, workspaceID, pollID primitive.ObjectID) (*Poll, error) {
+	var poll Poll
+	err := s.pollCollection.FindOne(ctx, bson.M{
+		"_id":          pollID,
+		"workspace_id": workspaceID,
+		"deleted_at":   bson.M{"$exists": true},
+	}).Decode(&poll)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// RestorePoll undoes SoftDeletePoll while the restore window is open. A
+// poll a moderator deleted is only restored if moderated is set.
+func (s *PollService) RestorePoll(ctx context.Context, workspaceID, pollID primitive.ObjectID, moderated bool) (*Poll, error) {
+	filter := bson.M{
+		"_id":          pollID,
+		"workspace_id": workspaceID,
+		"deleted_at":   bson.M{"$gt": time.Now().Add(-s.restoreWindow)},
+	}
+	if !moderated {
+		filter["deleted_by_moderator"] = bson.M{"$ne": true}
+	}
+
+	var poll Poll
+	err := s.pollCollection.FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by_moderator": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&poll)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// PurgeDeletedPolls removes the polls whose restore window has closed,
+// with everything DeletePoll cascades to. Each step is idempotent, so a
+// purge cut short is finished by the next one, on any instance.
+func (s *PollService) PurgeDeletedPolls(ctx context.Context) (int, error) {
+	cursor, err := s.pollCollection.Find(ctx, bson.M{
+		"deleted_at": bson.M{"$lte": time.Now().Add(-s.restoreWindow)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var polls []Poll
+	if err := cursor.All(ctx, &polls); err != nil {
+		return 0, err
+	}
+
+	for i := range polls {
+		if err := s.DeletePoll(ctx, &polls[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(polls), nil
+}
@@ -1,29 +1,46 @@
 package poll
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
 	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/vote"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type PollHandler struct {
-	pollService *PollService
-	clients     map[string]map[chan *Poll]bool
-	mutex       sync.RWMutex
+	pollService      *PollService
+	workspaceService *workspace.WorkspaceService
+	sessionService *session.SessionService
+	auditLog       *audit.AuditService
+	clients        map[string]map[chan streamEvent]bool
+	// known is what the clients of each followed poll last heard about
+	// it, so SweepWatched can tell when that changed.
+	known          map[string]pollState
+	mutex          sync.RWMutex
 }
 
-func NewPollHandler(pollService *PollService) *PollHandler {
+func NewPollHandler(pollService *PollService, workspaceService *workspace.WorkspaceService, sessionService *session.SessionService, auditLog *audit.AuditService) *PollHandler {
 	return &PollHandler{
-		pollService: pollService,
-		clients:     make(map[string]map[chan *Poll]bool),
+		pollService:      pollService,
+		workspaceService: workspaceService,
+		sessionService: sessionService,
+		auditLog:       auditLog,
+		clients:        make(map[string]map[chan streamEvent]bool),
+		known:          make(map[string]pollState),
 	}
 }
 
@@ -31,8 +48,10 @@ func (h *PollHandler) CreatePoll(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Question        string   `json:"question"`
 		Options         []string `json:"options"`
-		UserID          string   `json:"user_id"`
-		MultipleChoices bool     `json:"multiple_choices"`
+		MultipleChoices bool       `json:"multiple_choices"`
+		StartsAt        *time.Time `json:"starts_at"`
+		EndsAt          *time.Time `json:"ends_at"`
+		Access
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -40,22 +59,179 @@ func (h *PollHandler) CreatePoll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := primitive.ObjectIDFromHex(req.UserID)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ws, _, ok := workspace.FromContext(r.Context())
+	if !ok {
+		http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if req.EndsAt != nil && !req.EndsAt.After(time.Now()) {
+		http.Error(w, "The end time must be in the future", http.StatusBadRequest)
+		return
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		http.Error(w, "The end time must be after the start time", http.StatusBadRequest)
 		return
 	}
 
-	poll, err := h.pollService.CreatePoll(r.Context(), req.Question, req.Options, userID, req.MultipleChoices)
+	poll, err := h.pollService.CreatePoll(r.Context(), ws.ID, req.Question, req.Options, caller.ID, req.MultipleChoices, req.StartsAt, req.EndsAt, req.Access)
+	if err == ErrInvalidAccess {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollCreate, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetPoll, poll.ID.Hex()))
 
 	json.NewEncoder(w).Encode(poll)
 }
 
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// listedPoll is a poll in a listing, with the workspace it belongs to so
+// listings across workspaces can link to it.
+type listedPoll struct {
+	Poll
+	Workspace workspace.Workspace `json:"workspace"`
+}
+
+type page struct {
+	Items      []listedPoll `json:"items"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// ListPolls pages through the polls the caller can see: those of the
+// workspace in the URL, or of every workspace they belong to when called
+// as /polls. The filters are creator (an ID or "me"), status (active or
+// closed), created_after, q (searches the question) and workspace (a slug,
+// on /polls only). status=deleted lists the caller's own deleted polls that
+// can still be restored. Pages are sorted by sort and continue from cursor.
+func (h *PollHandler) ListPolls(w http.ResponseWriter, r *http.Request) {
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	params := r.URL.Query()
+
+	// Polls are only ever listed from the caller's own workspaces
+	workspaces := make(map[primitive.ObjectID]workspace.Workspace)
+	if ws, _, ok := workspace.FromContext(r.Context()); ok {
+		workspaces[ws.ID] = *ws
+	} else {
+		memberships, err := h.workspaceService.ListForUser(r.Context(), caller.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slug := params.Get("workspace")
+		for _, m := range memberships {
+			if slug == "" || m.Slug == slug {
+				workspaces[m.ID] = m.Workspace
+			}
+		}
+		if slug != "" && len(workspaces) == 0 {
+			http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	q := Query{Text: params.Get("q"), Sort: Sort(params.Get("sort")), ViewerID: caller.ID}
+	if caller.EmailVerified {
+		q.ViewerEmail = strings.ToLower(caller.Email)
+	}
+	for id := range workspaces {
+		q.WorkspaceIDs = append(q.WorkspaceIDs, id)
+	}
+
+	switch creator := params.Get("creator"); creator {
+	case "":
+	case "me":
+		q.CreatedBy = caller.ID
+	default:
+		id, err := primitive.ObjectIDFromHex(creator)
+		if err != nil {
+			http.Error(w, "Invalid creator", http.StatusBadRequest)
+			return
+		}
+		q.CreatedBy = id
+	}
+
+	switch status := params.Get("status"); status {
+	case "":
+	case "active", "closed":
+		active := status == "active"
+		q.Active = &active
+	case "deleted":
+		q.Deleted = true
+		q.CreatedBy = caller.ID
+	default:
+		http.Error(w, "Status must be active, closed or deleted", http.StatusBadRequest)
+		return
+	}
+
+	if after := params.Get("created_after"); after != "" {
+		t, err := time.Parse(time.RFC3339, after)
+		if err != nil {
+			http.Error(w, "created_after must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		q.CreatedAfter = t
+	}
+
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+	if !q.Sort.Valid() {
+		http.Error(w, "Sort must be newest, votes or ending_soon", http.StatusBadRequest)
+		return
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		after, err := DecodeCursor(cursor, q.Sort)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.After = after
+	}
+
+	q.Limit, _ = strconv.ParseInt(params.Get("limit"), 10, 64)
+	if q.Limit <= 0 {
+		q.Limit = defaultPageSize
+	}
+	q.Limit = min(q.Limit, maxPageSize)
+
+	polls, next, err := h.pollService.SearchPolls(r.Context(), q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := page{Items: make([]listedPoll, len(polls))}
+	for i, p := range polls {
+		resp.Items[i] = listedPoll{Poll: *p.viewFor(caller), Workspace: workspaces[p.WorkspaceID]}
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 type PollWithUserVote struct {
     *Poll
     UserVote *vote.UserVoteResponse `json:"user_vote"`
@@ -68,29 +244,36 @@ func (h *PollHandler) GetPoll(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Get user ID from query parameter
-    userIDStr := r.URL.Query().Get("userId")
-    userID, err := primitive.ObjectIDFromHex(userIDStr)
-    if err != nil {
-        http.Error(w, "Invalid user ID", http.StatusBadRequest)
+    caller, ok := user.FromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+    ws, _, ok := workspace.FromContext(r.Context())
+    if !ok {
+        http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
         return
     }
 
-    poll, err := h.pollService.GetPoll(r.Context(), pollID)
+    poll, err := h.pollService.GetVisiblePoll(r.Context(), ws.ID, pollID, caller)
+    if err == ErrPollNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
 
-    // Get user's vote
-    userVote, err := h.pollService.voteService.GetUserVote(r.Context(), pollID, userID)
+    // Include the caller's own ballot, if they have cast one
+    userVote, err := h.pollService.voteService.GetUserVote(r.Context(), pollID, caller.ID)
     if err != nil && err != mongo.ErrNoDocuments {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
 
     response := PollWithUserVote{
-        Poll:     poll,
+        Poll:     poll.viewFor(caller),
         UserVote: &userVote,
     }
 
@@ -100,7 +283,6 @@ func (h *PollHandler) GetPoll(w http.ResponseWriter, r *http.Request) {
 
 func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		UserID    string   `json:"user_id"`
 		OptionIDs []string `json:"option_ids"`
 	}
 
@@ -115,9 +297,14 @@ func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := primitive.ObjectIDFromHex(req.UserID)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ws, _, ok := workspace.FromContext(r.Context())
+	if !ok {
+		http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -130,11 +317,29 @@ func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = h.pollService.Vote(r.Context(), pollID, userID, optionIDs)
+	err = h.pollService.Vote(r.Context(), ws.ID, pollID, caller, optionIDs)
+	if err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == ErrInvalidOption {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == ErrPollClosed || err == ErrVotingNotStarted || err == ErrVotingEnded {
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionVote, audit.OutcomeFailure).
+			By(caller.ID, caller.Email).On(audit.TargetPoll, pollID.Hex()).Because(err.Error()))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionVote, audit.OutcomeFailure).
+			By(caller.ID, caller.Email).On(audit.TargetPoll, pollID.Hex()).Because(err.Error()))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionVote, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetPoll, pollID.Hex()))
 
 	// Fetch the updated poll
 	updatedPoll, err := h.pollService.GetPoll(r.Context(), pollID)
@@ -144,20 +349,451 @@ func (h *PollHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Notify all clients subscribed to this poll
-	h.notifyClients(pollID.Hex(), updatedPoll)
+	h.notifyClients(pollID.Hex(), streamEvent{poll: updatedPoll})
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// ClosePoll stops a poll from taking votes. Only its creator can close it.
+func (h *PollHandler) ClosePoll(w http.ResponseWriter, r *http.Request) {
+	h.setActive(w, r, false)
+}
+
+// ReopenPoll lets a closed poll take votes again. Only its creator can
+// reopen it.
+func (h *PollHandler) ReopenPoll(w http.ResponseWriter, r *http.Request) {
+	h.setActive(w, r, true)
+}
+
+func (h *PollHandler) setActive(w http.ResponseWriter, r *http.Request, active bool) {
+	pollID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ws, _, ok := workspace.FromContext(r.Context())
+	if !ok {
+		http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	poll, err := h.pollService.GetVisiblePoll(r.Context(), ws.ID, pollID, caller)
+	if err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if poll.CreatedBy != caller.ID {
+		http.Error(w, "Only the creator of a poll can close or reopen it", http.StatusForbidden)
+		return
+	}
+
+	// Closing a closed poll or reopening an open one changes nothing. A poll
+	// waiting for its start is neither: closing it keeps the scheduler from
+	// opening it, and reopening it opens it now.
+	waiting := !poll.Active && poll.ClosedAt == nil && poll.StartsAt != nil
+	if poll.Active != active || waiting {
+		poll, err = h.pollService.SetActive(r.Context(), ws.ID, pollID, active)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		action, event := audit.ActionPollClose, eventClosed
+		if active {
+			action, event = audit.ActionPollReopen, eventOpened
+		}
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, action, audit.OutcomeSuccess).
+			By(caller.ID, caller.Email).On(audit.TargetPoll, pollID.Hex()))
+		h.notifyClients(pollID.Hex(), streamEvent{name: event, poll: poll})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// EditPoll changes the question and options of a poll. Only its creator can
+// edit it, and once it has votes only within the limits of Edit.
+func (h *PollHandler) EditPoll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Question *string      `json:"question"`
+		Options  []OptionEdit `json:"options"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pollID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+		return
+	}
+
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ws, _, ok := workspace.FromContext(r.Context())
+	if !ok {
+		http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	poll, err := h.pollService.GetVisiblePoll(r.Context(), ws.ID, pollID, caller)
+	if err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if poll.CreatedBy != caller.ID {
+		http.Error(w, "Only the creator of a poll can edit it", http.StatusForbidden)
+		return
+	}
+
+	revision := poll.Revision
+	poll, err = h.pollService.EditPoll(r.Context(), ws.ID, pollID, caller.ID, Edit{Question: req.Question, Options: req.Options})
+	switch err {
+	case nil:
+	case ErrPollNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case ErrInvalidEdit, ErrInvalidOption:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case ErrOptionHasVotes, ErrQuestionHasVotes, ErrEditConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if poll.Revision != revision {
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollEdit, audit.OutcomeSuccess).
+			By(caller.ID, caller.Email).
+			On(audit.TargetPoll, pollID.Hex()).
+			With("revision", strconv.Itoa(poll.Revision)))
+		h.notifyClients(pollID.Hex(), streamEvent{name: eventEdited, poll: poll})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// ListRevisions returns the history of a poll's question and options.
+func (h *PollHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	pollID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+		return
+	}
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ws, _, ok := workspace.FromContext(r.Context())
+	if !ok {
+		http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if _, err := h.pollService.GetVisiblePoll(r.Context(), ws.ID, pollID, caller); err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := h.pollService.ListRevisions(r.Context(), pollID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// DeletePoll deletes a poll for its creator. The poll can be restored until
+// the restore window closes; its followers are told it is gone right away.
+func (h *PollHandler) DeletePoll(w http.ResponseWriter, r *http.Request) {
+	caller, poll, ok := h.creatorPoll(w, r, h.pollService.GetWorkspacePoll)
+	if !ok {
+		return
+	}
+
+	if _, err := h.pollService.SoftDeletePoll(r.Context(), poll.WorkspaceID, poll.ID, false); err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollDelete, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetPoll, poll.ID.Hex()))
+	h.notifyClients(poll.ID.Hex(), streamEvent{name: eventDeleted})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestorePoll brings back a poll its creator deleted, while the restore
+// window is open.
+func (h *PollHandler) RestorePoll(w http.ResponseWriter, r *http.Request) {
+	caller, poll, ok := h.creatorPoll(w, r, h.pollService.GetDeletedPoll)
+	if !ok {
+		return
+	}
+	if !poll.RestorableBy(caller) {
+		http.Error(w, ErrDeletedByModerator.Error(), http.StatusForbidden)
+		return
+	}
+	if !poll.Restorable(time.Now(), h.pollService.restoreWindow) {
+		http.Error(w, ErrRestoreWindowClosed.Error(), http.StatusGone)
+		return
+	}
+
+	poll, err := h.pollService.RestorePoll(r.Context(), poll.WorkspaceID, poll.ID, caller.Can(user.PermModeratePolls))
+	if err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollRestore, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetPoll, poll.ID.Hex()))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// SetAccess changes who can see a poll. Only its creator can change it.
+// Followers who can no longer see it are disconnected.
+func (h *PollHandler) SetAccess(w http.ResponseWriter, r *http.Request) {
+	var req Access
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	caller, poll, ok := h.creatorPoll(w, r, h.pollService.GetWorkspacePoll)
+	if !ok {
+		return
+	}
+
+	poll, err := h.pollService.SetAccess(r.Context(), poll.WorkspaceID, poll.ID, req)
+	switch err {
+	case nil:
+	case ErrInvalidAccess:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case ErrPollNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollVisibility, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetPoll, poll.ID.Hex()).
+		With("visibility", string(poll.Visibility)))
+	h.notifyClients(poll.ID.Hex(), streamEvent{name: eventVisibility, poll: poll})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// creatorPoll looks up the poll in the URL with get and checks that the
+// caller created it. It answers the request itself when it returns false.
+func (h *PollHandler) creatorPoll(w http.ResponseWriter, r *http.Request, get func(ctx context.Context, workspaceID, pollID primitive.ObjectID) (*Poll, error)) (*user.User, *Poll, bool) {
+	pollID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	ws, _, ok := workspace.FromContext(r.Context())
+	if !ok {
+		http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	poll, err := get(r.Context(), ws.ID, pollID)
+	if err == nil && !poll.VisibleTo(caller) {
+		err = ErrPollNotFound
+	}
+	if err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if poll.CreatedBy != caller.ID {
+		http.Error(w, "Only the creator of a poll can change it", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return caller, poll, true
+}
+
+// streamEvent is one message to the clients following a poll. Vote updates
+// go out unnamed; changes such as closing the poll are named so clients can
+// tell them apart. A deleted event carries no poll and ends the stream.
+type streamEvent struct {
+	name string
+	poll *Poll
+}
+
+const (
+	eventOpened     = "opened"
+	eventClosed     = "closed"
+	eventEdited     = "edited"
+	eventVisibility = "visibility"
+	eventDeleted    = "deleted"
+)
+
+// pollState is what SweepWatched compares to notice changes made elsewhere.
+type pollState struct {
+	active bool
+	access Access
+}
+
+func stateOf(p *Poll) pollState {
+	return pollState{active: p.Active, access: p.Access}
+}
+
+func (s pollState) equal(o pollState) bool {
+	return s.active == o.active && s.access.equal(o.access)
+}
+
+// SweepWatched checks every interval whether the polls that clients follow
+// opened, closed or changed who can see them, and tells those clients. This
+// catches polls changed by the scheduler or by another instance, which never
+// pass through this handler. It runs until ctx is cancelled.
+func (h *PollHandler) SweepWatched(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.sweepWatched(ctx); err != nil {
+				log.Printf("Error checking followed polls: %v", err)
+			}
+		}
+	}
+}
+
+func (h *PollHandler) sweepWatched(ctx context.Context) error {
+	h.mutex.RLock()
+	ids := make([]primitive.ObjectID, 0, len(h.clients))
+	for id := range h.clients {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			ids = append(ids, oid)
+		}
+	}
+	h.mutex.RUnlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	polls, err := h.pollService.GetPolls(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	// Polls that were not found were deleted, perhaps through another
+	// instance
+	found := make(map[primitive.ObjectID]bool, len(polls))
+	for _, p := range polls {
+		found[p.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			h.notifyClients(id.Hex(), streamEvent{name: eventDeleted})
+		}
+	}
+
+	for i := range polls {
+		poll := &polls[i]
+		id := poll.ID.Hex()
+		h.mutex.RLock()
+		known, ok := h.known[id]
+		h.mutex.RUnlock()
+		state := stateOf(poll)
+		if !ok || known.equal(state) {
+			continue
+		}
+		event := eventVisibility
+		if known.active != state.active {
+			event = eventClosed
+			if poll.Active {
+				event = eventOpened
+			}
+		}
+		h.notifyClients(id, streamEvent{name: event, poll: poll})
+	}
+	return nil
+}
+
 func (h *PollHandler) StreamPollUpdates(w http.ResponseWriter, r *http.Request) {
     pollID := mux.Vars(r)["id"]
 
+    // Only members of the poll's workspace who may see it can follow it
+    caller, ok := user.FromContext(r.Context())
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+    ws, _, ok := workspace.FromContext(r.Context())
+    if !ok {
+        http.Error(w, workspace.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+        return
+    }
+    id, err := primitive.ObjectIDFromHex(pollID)
+    if err != nil {
+        http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+        return
+    }
+    poll, err := h.pollService.GetVisiblePoll(r.Context(), ws.ID, id, caller)
+    if err == ErrPollNotFound {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    } else if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+
     // Set headers for SSE
     w.Header().Set("Content-Type", "text/event-stream")
     w.Header().Set("Cache-Control", "no-cache")
     w.Header().Set("Connection", "keep-alive")
-    w.Header().Set("Access-Control-Allow-Origin", "*")
-    w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
     flusher, ok := w.(http.Flusher)
     if !ok {
@@ -166,16 +802,26 @@ func (h *PollHandler) StreamPollUpdates(w http.ResponseWriter, r *http.Request)
     }
 
     // Create a channel for this client with a buffer
-    updateChan := make(chan *Poll, 10)
+    updateChan := make(chan streamEvent, 10)
 
     // Register the client
     h.mutex.Lock()
     if _, ok := h.clients[pollID]; !ok {
-        h.clients[pollID] = make(map[chan *Poll]bool)
+        h.clients[pollID] = make(map[chan streamEvent]bool)
+        h.known[pollID] = stateOf(poll)
     }
     h.clients[pollID][updateChan] = true
     h.mutex.Unlock()
 
+    // A stream opened with a session ends as soon as that session is
+    // revoked. Anonymous streams never see this channel fire.
+    var revoked <-chan struct{}
+    if sess, ok := session.FromContext(r.Context()); ok {
+        var stopWatching func()
+        revoked, stopWatching = h.sessionService.Watch(sess.ID)
+        defer stopWatching()
+    }
+
     // Create keep-alive ticker
     ticker := time.NewTicker(15 * time.Second)
     defer ticker.Stop()
@@ -188,6 +834,7 @@ func (h *PollHandler) StreamPollUpdates(w http.ResponseWriter, r *http.Request)
         delete(h.clients[pollID], updateChan)
         if len(h.clients[pollID]) == 0 {
             delete(h.clients, pollID)
+            delete(h.known, pollID)
         }
         h.mutex.Unlock()
         close(updateChan)
@@ -200,24 +847,43 @@ func (h *PollHandler) StreamPollUpdates(w http.ResponseWriter, r *http.Request)
     // Stream updates to the client
     for {
         select {
-        case poll, ok := <-updateChan:
+        case event, ok := <-updateChan:
             if !ok {
                 return
             }
+            if event.name == eventDeleted {
+                fmt.Fprintf(w, "event: deleted\ndata: {\"status\": \"deleted\"}\n\n")
+                flusher.Flush()
+                return
+            }
+            // The creator may have made the poll private since
+            if !event.poll.VisibleTo(caller) {
+                fmt.Fprintf(w, "event: forbidden\ndata: {\"status\": \"no longer visible\"}\n\n")
+                flusher.Flush()
+                return
+            }
             
-            data, err := json.Marshal(poll)
+            data, err := json.Marshal(event.poll.viewFor(caller))
             if err != nil {
                 fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
                 flusher.Flush()
                 return
             }
 
+            if event.name != "" {
+                fmt.Fprintf(w, "event: %s\n", event.name)
+            }
             _, err = fmt.Fprintf(w, "data: %s\n\n", data)
             if err != nil {
                 return
             }
             flusher.Flush()
 
+        case <-revoked:
+            fmt.Fprintf(w, "event: revoked\ndata: {\"status\": \"session revoked\"}\n\n")
+            flusher.Flush()
+            return
+
         case <-ticker.C:
             // Send keep-alive message
             _, err := fmt.Fprintf(w, ": keepalive\n\n")
@@ -233,14 +899,20 @@ func (h *PollHandler) StreamPollUpdates(w http.ResponseWriter, r *http.Request)
     }
 }
 
-func (h *PollHandler) notifyClients(pollID string, poll *Poll) {
-    h.mutex.RLock()
-    defer h.mutex.RUnlock()
+func (h *PollHandler) notifyClients(pollID string, event streamEvent) {
+    h.mutex.Lock()
+    defer h.mutex.Unlock()
+
+    // Vote updates carry the poll too, but only a named event tells the
+    // clients that it changed
+    if _, ok := h.known[pollID]; ok && event.name != "" && event.poll != nil {
+        h.known[pollID] = stateOf(event.poll)
+    }
 
     if clients, ok := h.clients[pollID]; ok {
         for clientChan := range clients {
             select {
-            case clientChan <- poll:
+            case clientChan <- event:
                 // Successfully sent
             default:
                 // Channel is full, log it
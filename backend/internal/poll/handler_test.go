@@ -0,0 +1,112 @@
+package poll
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreatorPoll(t *testing.T) {
+	ws := &workspace.Workspace{ID: primitive.NewObjectID()}
+	creator := &user.User{ID: primitive.NewObjectID()}
+	other := &user.User{ID: primitive.NewObjectID()}
+	public := &Poll{ID: primitive.NewObjectID(), WorkspaceID: ws.ID, CreatedBy: creator.ID}
+	private := &Poll{ID: primitive.NewObjectID(), WorkspaceID: ws.ID, CreatedBy: creator.ID,
+		Access: Access{Visibility: VisibilityPrivate}}
+
+	cases := map[string]struct {
+		id     string
+		caller *user.User
+		poll   *Poll
+		want   int
+	}{
+		"creator":         {public.ID.Hex(), creator, public, http.StatusOK},
+		"other member":    {public.ID.Hex(), other, public, http.StatusForbidden},
+		"private, hidden": {private.ID.Hex(), other, private, http.StatusNotFound},
+		"missing":         {primitive.NewObjectID().Hex(), creator, nil, http.StatusNotFound},
+		"bad id":          {"nope", creator, public, http.StatusBadRequest},
+	}
+	for name, c := range cases {
+		get := func(ctx context.Context, workspaceID, pollID primitive.ObjectID) (*Poll, error) {
+			if c.poll == nil || c.poll.ID != pollID || c.poll.WorkspaceID != workspaceID {
+				return nil, ErrPollNotFound
+			}
+			return c.poll, nil
+		}
+		r := httptest.NewRequest(http.MethodDelete, "/", nil)
+		ctx := user.NewContext(r.Context(), c.caller)
+		ctx = workspace.NewContext(ctx, ws, &workspace.Member{WorkspaceID: ws.ID, UserID: c.caller.ID})
+		r = mux.SetURLVars(r.WithContext(ctx), map[string]string{"id": c.id})
+		w := httptest.NewRecorder()
+
+		_, poll, ok := (&PollHandler{}).creatorPoll(w, r, get)
+		got := w.Code
+		if ok {
+			got = http.StatusOK
+		}
+		if got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+		if ok && poll != c.poll {
+			t.Errorf("%s: expected the looked up poll; got %v", name, poll)
+		}
+	}
+}
+
+func TestRestorable(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	cases := map[string]struct {
+		deletedAt *time.Time
+		want      bool
+	}{
+		"not deleted":       {nil, false},
+		"just deleted":      {at(-time.Minute), true},
+		"inside the window": {at(-23 * time.Hour), true},
+		"window closed":     {at(-24 * time.Hour), false},
+		"waiting for purge": {at(-48 * time.Hour), false},
+	}
+	for name, c := range cases {
+		p := &Poll{DeletedAt: c.deletedAt}
+		if got := p.Restorable(now, 24*time.Hour); got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+}
+
+func TestRestorableBy(t *testing.T) {
+	creator := &user.User{ID: primitive.NewObjectID()}
+	moderatingCreator := &user.User{ID: creator.ID, Role: user.RoleModerator}
+	other := &user.User{ID: primitive.NewObjectID()}
+	moderator := &user.User{ID: primitive.NewObjectID(), Role: user.RoleModerator}
+
+	byCreator := &Poll{CreatedBy: creator.ID}
+	byModerator := &Poll{CreatedBy: creator.ID, DeletedByModerator: true}
+	cases := map[string]struct {
+		poll *Poll
+		user *user.User
+		want bool
+	}{
+		"creator, own delete":       {byCreator, creator, true},
+		"other, own delete":         {byCreator, other, false},
+		"creator, moderated":        {byModerator, creator, false},
+		"moderating creator":        {byModerator, moderatingCreator, true},
+		"moderator, moderated":      {byModerator, moderator, true},
+		"moderator, creator delete": {byCreator, moderator, false},
+	}
+	for name, c := range cases {
+		if got := c.poll.RestorableBy(c.user); got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+}
@@ -8,12 +8,48 @@ import (
 
 type Poll struct {
 	ID        primitive.ObjectID   `bson:"_id" json:"id"`
+	WorkspaceID primitive.ObjectID `bson:"workspace_id" json:"workspace_id"`
 	Question  string               `bson:"question" json:"question"`
 	Options   []Option             `bson:"options" json:"options"`
 	CreatedBy primitive.ObjectID   `bson:"created_by" json:"created_by"`
 	CreatedAt time.Time            `bson:"created_at" json:"created_at"`
 	MultipleChoices bool           `bson:"multiple_choices" json:"multiple_choices"`
 	Active     bool                `bson:"active" json:"active"`
+	// ClosedAt is when the creator last closed the poll.
+	ClosedAt  *time.Time           `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	// VoteCount is the number of ballots cast, kept for sorting.
+	VoteCount int                  `bson:"vote_count" json:"vote_count"`
+	// StartsAt and EndsAt bound the window in which the poll takes votes,
+	// if the creator scheduled one.
+	StartsAt  *time.Time           `bson:"starts_at,omitempty" json:"starts_at,omitempty"`
+	EndsAt    *time.Time           `bson:"ends_at,omitempty" json:"ends_at,omitempty"`
+	// Revision counts the edits made since the poll was created.
+	Revision  int                  `bson:"revision" json:"revision"`
+	// DeletedAt is when the creator deleted the poll. It can be restored
+	// until the restore window has passed, and is purged after.
+	DeletedAt *time.Time           `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	// DeletedByModerator marks a poll a moderator deleted. Only moderators
+	// can restore it.
+	DeletedByModerator bool        `bson:"deleted_by_moderator,omitempty" json:"deleted_by_moderator,omitempty"`
+	Access                         `bson:",inline"`
+}
+
+// CheckOpen returns why the poll does not take votes at now, or nil if it
+// does. The schedule is checked against the clock rather than Active, which
+// the scheduler only catches up with a few seconds later.
+func (p *Poll) CheckOpen(now time.Time) error {
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return ErrVotingNotStarted
+	}
+	if p.EndsAt != nil && !now.Before(*p.EndsAt) {
+		return ErrVotingEnded
+	}
+	// A poll that was never closed is open once its start has passed, even
+	// before the scheduler marks it active
+	if !p.Active && (p.ClosedAt != nil || p.StartsAt == nil) {
+		return ErrPollClosed
+	}
+	return nil
 }
 
 type Option struct {
@@ -0,0 +1,77 @@
+package poll
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckOpen(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	cases := map[string]struct {
+		poll Poll
+		want error
+	}{
+		"open":                   {Poll{Active: true}, nil},
+		"closed":                 {Poll{Active: false, ClosedAt: &past}, ErrPollClosed},
+		"inactive legacy":        {Poll{Active: false}, ErrPollClosed},
+		"not started":            {Poll{Active: false, StartsAt: &future}, ErrVotingNotStarted},
+		"started, not yet swept": {Poll{Active: false, StartsAt: &past}, nil},
+		"started, then closed":   {Poll{Active: false, StartsAt: &past, ClosedAt: &past}, ErrPollClosed},
+		"ended, not yet swept":   {Poll{Active: true, EndsAt: &past}, ErrVotingEnded},
+		"within the window":      {Poll{Active: true, StartsAt: &past, EndsAt: &future}, nil},
+	}
+	for name, c := range cases {
+		if got := c.poll.CheckOpen(now); got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+}
+
+// setActive applies to p what PollService.SetActive writes: reopening drops
+// a start still to come and an end already passed.
+func setActive(p Poll, active bool, now time.Time) Poll {
+	if !active {
+		p.Active, p.ClosedAt = false, &now
+		return p
+	}
+	p.Active, p.ClosedAt = true, nil
+	if p.StartsAt != nil && p.StartsAt.After(now) {
+		p.StartsAt = nil
+	}
+	if p.EndsAt != nil && !p.EndsAt.After(now) {
+		p.EndsAt = nil
+	}
+	return p
+}
+
+func TestCheckOpenAfterCloseAndReopen(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	cases := map[string]struct {
+		poll    Poll
+		actions []bool
+		want    error
+	}{
+		"closed":                      {Poll{Active: true}, []bool{false}, ErrPollClosed},
+		"closed, then reopened":       {Poll{Active: true}, []bool{false, true}, nil},
+		"waiting, closed":             {Poll{StartsAt: &future}, []bool{false}, ErrVotingNotStarted},
+		"waiting, closed, reopened":   {Poll{StartsAt: &future}, []bool{false, true}, nil},
+		"waiting, reopened":           {Poll{StartsAt: &future}, []bool{true}, nil},
+		"started, closed":             {Poll{StartsAt: &past}, []bool{false}, ErrPollClosed},
+		"ended, reopened":             {Poll{Active: false, ClosedAt: &past, EndsAt: &past}, []bool{true}, nil},
+		"reopened, keeps a later end": {Poll{Active: false, ClosedAt: &past, EndsAt: &future}, []bool{true}, nil},
+		"reopened, closed again":      {Poll{Active: false, ClosedAt: &past, EndsAt: &past}, []bool{true, false}, ErrPollClosed},
+	}
+	for name, c := range cases {
+		p := c.poll
+		for _, active := range c.actions {
+			p = setActive(p, active, now)
+		}
+		if got := p.CheckOpen(now); got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package poll
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ModerateClose closes any poll for a moderator, whoever created it.
+func (h *PollHandler) ModerateClose(w http.ResponseWriter, r *http.Request) {
+	caller, poll, ok := h.moderatedPoll(w, r, false)
+	if !ok {
+		return
+	}
+
+	// As for the creator, a poll waiting for its start is closed too so the
+	// scheduler does not open it.
+	if poll.Active || (poll.ClosedAt == nil && poll.StartsAt != nil) {
+		closed, err := h.pollService.SetActive(r.Context(), poll.WorkspaceID, poll.ID, false)
+		if err == ErrPollNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		poll = closed
+
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollClose, audit.OutcomeSuccess).
+			By(caller.ID, caller.Email).
+			On(audit.TargetPoll, poll.ID.Hex()).
+			With("moderated", "true"))
+		h.notifyClients(poll.ID.Hex(), streamEvent{name: eventClosed, poll: poll})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// ModerateDelete deletes any poll for a moderator, whoever created it. Its
+// creator cannot restore it; only ModerateRestore can, within the restore
+// window.
+func (h *PollHandler) ModerateDelete(w http.ResponseWriter, r *http.Request) {
+	caller, poll, ok := h.moderatedPoll(w, r, false)
+	if !ok {
+		return
+	}
+
+	if _, err := h.pollService.SoftDeletePoll(r.Context(), poll.WorkspaceID, poll.ID, true); err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollDelete, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetPoll, poll.ID.Hex()).
+		With("moderated", "true"))
+	h.notifyClients(poll.ID.Hex(), streamEvent{name: eventDeleted})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ModerateRestore restores any deleted poll for a moderator, including the
+// ones moderators deleted.
+func (h *PollHandler) ModerateRestore(w http.ResponseWriter, r *http.Request) {
+	caller, poll, ok := h.moderatedPoll(w, r, true)
+	if !ok {
+		return
+	}
+	if !poll.Restorable(time.Now(), h.pollService.restoreWindow) {
+		http.Error(w, ErrRestoreWindowClosed.Error(), http.StatusGone)
+		return
+	}
+
+	poll, err := h.pollService.RestorePoll(r.Context(), poll.WorkspaceID, poll.ID, true)
+	if err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionPollRestore, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetPoll, poll.ID.Hex()).
+		With("moderated", "true"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// moderatedPoll looks up the poll in the URL by its ID alone, since
+// moderators need not belong to its workspace, among the deleted polls or
+// the others. It answers the request itself when it returns false.
+func (h *PollHandler) moderatedPoll(w http.ResponseWriter, r *http.Request, deleted bool) (*user.User, *Poll, bool) {
+	pollID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	poll, err := h.pollService.GetPoll(r.Context(), pollID)
+	if err == mongo.ErrNoDocuments || err == nil && (poll.DeletedAt != nil) != deleted {
+		err = ErrPollNotFound
+	}
+	if err == ErrPollNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return caller, poll, true
+}
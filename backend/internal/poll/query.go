@@ -0,0 +1,154 @@
+package poll
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+type Sort string
+
+const (
+	SortNewest Sort = "newest"
+	SortVotes  Sort = "votes"
+	// SortEndingSoon lists open polls with a deadline, closest first.
+	// Polls without one are left out.
+	SortEndingSoon Sort = "ending_soon"
+)
+
+// Valid reports whether s is one of the known sort orders.
+func (s Sort) Valid() bool {
+	switch s {
+	case SortNewest, SortVotes, SortEndingSoon:
+		return true
+	}
+	return false
+}
+
+// Query selects a page of polls for a listing. Zero fields do not filter.
+type Query struct {
+	// WorkspaceIDs limits the listing to these workspaces. It is never
+	// empty for a real listing: callers only see their own workspaces.
+	WorkspaceIDs []primitive.ObjectID
+	CreatedBy    primitive.ObjectID
+	// Deleted lists deleted polls instead of the others.
+	Deleted      bool
+	Active       *bool
+	CreatedAfter time.Time
+	// Text is matched against the question with MongoDB's text search.
+	Text  string
+	Sort  Sort
+	After *Cursor
+	Limit int64
+	// ViewerID is who the listing is for. They see public polls, their own
+	// and the private ones they were invited to; ViewerEmail, if set, is
+	// their verified email.
+	ViewerID    primitive.ObjectID
+	ViewerEmail string
+}
+
+// Cursor marks the last poll of a page by the fields the page is sorted on,
+// so the next page starts right after it even as new polls come in.
+type Cursor struct {
+	Sort   Sort               `json:"s"`
+	ID     primitive.ObjectID `json:"id"`
+	Votes  int                `json:"v,omitempty"`
+	EndsAt time.Time          `json:"e,omitempty"`
+}
+
+func newCursor(sort Sort, p *Poll) *Cursor {
+	c := &Cursor{Sort: sort, ID: p.ID, Votes: p.VoteCount}
+	if p.EndsAt != nil {
+		c.EndsAt = *p.EndsAt
+	}
+	return c
+}
+
+// Encode returns the cursor as an opaque string for the client.
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor reads a cursor the client got from an earlier page sorted by
+// sort.
+func DecodeCursor(s string, sort Sort) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != sort || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func (q *Query) filter(now time.Time) bson.M {
+	filter := bson.M{
+		"workspace_id": bson.M{"$in": q.WorkspaceIDs},
+		"deleted_at":   bson.M{"$exists": q.Deleted},
+	}
+	if !q.CreatedBy.IsZero() {
+		filter["created_by"] = q.CreatedBy
+	}
+	if q.Active != nil {
+		filter["active"] = *q.Active
+	}
+	if !q.CreatedAfter.IsZero() {
+		filter["created_at"] = bson.M{"$gt": q.CreatedAfter}
+	}
+	if q.Text != "" {
+		filter["$text"] = bson.M{"$search": q.Text}
+	}
+	if q.Sort == SortEndingSoon {
+		filter["ends_at"] = bson.M{"$gt": now}
+	}
+
+	visible := bson.A{
+		bson.M{"visibility": bson.M{"$in": bson.A{VisibilityPublic, nil}}},
+		bson.M{"created_by": q.ViewerID},
+		bson.M{"visibility": VisibilityPrivate, "invited_users": q.ViewerID},
+	}
+	if q.ViewerEmail != "" {
+		visible = append(visible, bson.M{"visibility": VisibilityPrivate, "invited_emails": q.ViewerEmail})
+	}
+	and := bson.A{bson.M{"$or": visible}}
+
+	if c := q.After; c != nil {
+		switch q.Sort {
+		case SortVotes:
+			and = append(and, bson.M{"$or": bson.A{
+				bson.M{"vote_count": bson.M{"$lt": c.Votes}},
+				bson.M{"vote_count": c.Votes, "_id": bson.M{"$lt": c.ID}},
+			}})
+		case SortEndingSoon:
+			and = append(and, bson.M{"$or": bson.A{
+				bson.M{"ends_at": bson.M{"$gt": c.EndsAt}},
+				bson.M{"ends_at": c.EndsAt, "_id": bson.M{"$gt": c.ID}},
+			}})
+		default:
+			filter["_id"] = bson.M{"$lt": c.ID}
+		}
+	}
+	filter["$and"] = and
+	return filter
+}
+
+// order sorts on the cursor fields, with the ID breaking ties.
+func (q *Query) order() bson.D {
+	switch q.Sort {
+	case SortVotes:
+		return bson.D{{Key: "vote_count", Value: -1}, {Key: "_id", Value: -1}}
+	case SortEndingSoon:
+		return bson.D{{Key: "ends_at", Value: 1}, {Key: "_id", Value: 1}}
+	default:
+		return bson.D{{Key: "_id", Value: -1}}
+	}
+}
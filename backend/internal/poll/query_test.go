@@ -0,0 +1,80 @@
+package poll
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	endsAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := &Poll{ID: primitive.NewObjectID(), VoteCount: 7, EndsAt: &endsAt}
+
+	c, err := DecodeCursor(newCursor(SortEndingSoon, p).Encode(), SortEndingSoon)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if c.ID != p.ID || c.Votes != 7 || !c.EndsAt.Equal(endsAt) {
+		t.Errorf("expected the poll's sort fields; got %+v", c)
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	valid := newCursor(SortVotes, &Poll{ID: primitive.NewObjectID()}).Encode()
+	cases := map[string]string{
+		"other sort": valid,
+		"not base64": "%%%",
+		"not json":   "bm90IGpzb24",
+		"no id":      (&Cursor{Sort: SortNewest}).Encode(),
+	}
+	for name, s := range cases {
+		if _, err := DecodeCursor(s, SortNewest); err != ErrInvalidCursor {
+			t.Errorf("%s: expected ErrInvalidCursor; got %v", name, err)
+		}
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	now := time.Now()
+	active := false
+	after := &Cursor{Sort: SortVotes, ID: primitive.NewObjectID(), Votes: 3}
+	q := Query{
+		WorkspaceIDs: []primitive.ObjectID{primitive.NewObjectID()},
+		Active:       &active,
+		Text:         "lunch",
+		Sort:         SortVotes,
+		After:        after,
+	}
+
+	filter := q.filter(now)
+	if filter["active"] != false {
+		t.Errorf("active: expected false; got %v", filter["active"])
+	}
+	if _, ok := filter["created_by"]; ok {
+		t.Errorf("created_by: expected no filter; got %v", filter["created_by"])
+	}
+	if text, _ := filter["$text"].(bson.M); text["$search"] != "lunch" {
+		t.Errorf("$text: expected a search for lunch; got %v", filter["$text"])
+	}
+	and, _ := filter["$and"].(bson.A)
+	if len(and) != 2 {
+		t.Fatalf("$and: expected the visibility and cursor clauses; got %v", filter["$and"])
+	}
+	if visible, _ := and[0].(bson.M)["$or"].(bson.A); len(visible) != 3 {
+		t.Errorf("visibility: expected public, own and invited polls; got %v", and[0])
+	}
+	if after, _ := and[1].(bson.M)["$or"].(bson.A); len(after) != 2 {
+		t.Errorf("cursor: expected a clause for fewer votes and one for ties; got %v", and[1])
+	}
+
+	if deleted, _ := filter["deleted_at"].(bson.M); deleted["$exists"] != false {
+		t.Errorf("deleted_at: expected deleted polls to be left out; got %v", filter["deleted_at"])
+	}
+
+	q.Sort, q.After = SortEndingSoon, nil
+	if _, ok := q.filter(now)["ends_at"]; !ok {
+		t.Errorf("ending_soon: expected polls without a deadline to be left out")
+	}
+}
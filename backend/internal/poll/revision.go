@@ -0,0 +1,213 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidEdit      = errors.New("A poll needs a question and at least one option, and options need text")
+	ErrOptionHasVotes   = errors.New("Options that have votes cannot be changed or removed")
+	ErrQuestionHasVotes = errors.New("The question of a poll that has votes can only have its spacing or case fixed")
+	ErrEditConflict     = errors.New("The poll changed while it was being edited; try again")
+)
+
+// editAttempts bounds how often EditPoll retries when votes keep coming in
+// between reading the poll and writing the edit.
+const editAttempts = 3
+
+// Revision is the question and options of a poll as they were after one
+// edit. Revision 0 is the poll as created.
+type Revision struct {
+	ID       primitive.ObjectID `bson:"_id" json:"id"`
+	PollID   primitive.ObjectID `bson:"poll_id" json:"poll_id"`
+	Number   int                `bson:"number" json:"number"`
+	Question string             `bson:"question" json:"question"`
+	Options  []RevisionOption   `bson:"options" json:"options"`
+	EditedBy primitive.ObjectID `bson:"edited_by" json:"edited_by"`
+	EditedAt time.Time          `bson:"edited_at" json:"edited_at"`
+}
+
+type RevisionOption struct {
+	ID   primitive.ObjectID `bson:"_id" json:"id"`
+	Text string             `bson:"text" json:"text"`
+}
+
+func newRevision(p *Poll, editedBy primitive.ObjectID, editedAt time.Time) *Revision {
+	opts := make([]RevisionOption, len(p.Options))
+	for i, o := range p.Options {
+		opts[i] = RevisionOption{ID: o.ID, Text: o.Text}
+	}
+	return &Revision{
+		ID:       primitive.NewObjectID(),
+		PollID:   p.ID,
+		Number:   p.Revision,
+		Question: p.Question,
+		Options:  opts,
+		EditedBy: editedBy,
+		EditedAt: editedAt,
+	}
+}
+
+// Edit describes a poll's new question and options. A nil field is left as
+// it is. Options lists every option in its new order: existing ones by ID,
+// new ones without.
+type Edit struct {
+	Question *string
+	Options  []OptionEdit
+}
+
+type OptionEdit struct {
+	ID   primitive.ObjectID `json:"id"`
+	Text string             `json:"text"`
+}
+
+// apply returns the poll's question and options after e. Until the first
+// vote anything goes; after it, options that have votes must be kept as they
+// are and the question may only have its spacing or case fixed, so no ballot
+// ends up counted for something it did not choose.
+func (e *Edit) apply(p *Poll) (string, []Option, error) {
+	question := p.Question
+	if e.Question != nil {
+		question = strings.TrimSpace(*e.Question)
+	}
+	if question == "" {
+		return "", nil, ErrInvalidEdit
+	}
+	if p.VoteCount > 0 && !sameWording(question, p.Question) {
+		return "", nil, ErrQuestionHasVotes
+	}
+	if e.Options == nil {
+		return question, p.Options, nil
+	}
+	if len(e.Options) == 0 {
+		return "", nil, ErrInvalidEdit
+	}
+
+	existing := make(map[primitive.ObjectID]Option, len(p.Options))
+	for _, o := range p.Options {
+		existing[o.ID] = o
+	}
+	kept := make(map[primitive.ObjectID]bool, len(e.Options))
+	opts := make([]Option, len(e.Options))
+	for i, oe := range e.Options {
+		text := strings.TrimSpace(oe.Text)
+		if text == "" {
+			return "", nil, ErrInvalidEdit
+		}
+		if oe.ID.IsZero() {
+			opts[i] = Option{ID: primitive.NewObjectID(), Text: text}
+			continue
+		}
+
+		o, ok := existing[oe.ID]
+		if !ok || kept[oe.ID] {
+			return "", nil, ErrInvalidOption
+		}
+		if o.Count > 0 && o.Text != text {
+			return "", nil, ErrOptionHasVotes
+		}
+		kept[oe.ID] = true
+		o.Text = text
+		opts[i] = o
+	}
+	for _, o := range p.Options {
+		if o.Count > 0 && !kept[o.ID] {
+			return "", nil, ErrOptionHasVotes
+		}
+	}
+	return question, opts, nil
+}
+
+// sameWording reports whether a and b differ at most in spacing and case.
+func sameWording(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// unchanged reports whether question and opts are what p already has.
+func unchanged(p *Poll, question string, opts []Option) bool {
+	if question != p.Question || len(opts) != len(p.Options) {
+		return false
+	}
+	for i := range opts {
+		if opts[i].ID != p.Options[i].ID || opts[i].Text != p.Options[i].Text {
+			return false
+		}
+	}
+	return true
+}
+
+// EditPoll applies e to a poll of the workspace, records the result as a new
+// revision and returns the poll as updated. The write only goes through if
+// the options, counts included, are still as they were read, so a vote cast
+// meanwhile is never lost; EditPoll then starts over from the new counts.
+func (s *PollService) EditPoll(ctx context.Context, workspaceID, pollID, editedBy primitive.ObjectID, e Edit) (*Poll, error) {
+	for attempt := 0; attempt < editAttempts; attempt++ {
+		poll, err := s.GetWorkspacePoll(ctx, workspaceID, pollID)
+		if err != nil {
+			return nil, err
+		}
+		question, opts, err := e.apply(poll)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged(poll, question, opts) {
+			return poll, nil
+		}
+
+		// Polls from before revisions were kept get their original content
+		// recorded first
+		if poll.Revision == 0 {
+			_, err := s.revisionCollection.UpdateOne(ctx,
+				bson.M{"poll_id": poll.ID, "number": 0},
+				bson.M{"$setOnInsert": newRevision(poll, poll.CreatedBy, poll.CreatedAt)},
+				options.Update().SetUpsert(true))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var revision interface{} = poll.Revision
+		if poll.Revision == 0 {
+			revision = bson.M{"$in": bson.A{0, nil}}
+		}
+		res, err := s.pollCollection.UpdateOne(ctx,
+			bson.M{"_id": poll.ID, "revision": revision, "options": poll.Options, "deleted_at": notDeleted},
+			bson.M{"$set": bson.M{"question": question, "options": opts, "revision": poll.Revision + 1}})
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			continue
+		}
+
+		poll.Question, poll.Options, poll.Revision = question, opts, poll.Revision+1
+		if _, err := s.revisionCollection.InsertOne(ctx, newRevision(poll, editedBy, time.Now())); err != nil {
+			return nil, err
+		}
+		return poll, nil
+	}
+	return nil, ErrEditConflict
+}
+
+// ListRevisions returns a poll's revisions, oldest first.
+func (s *PollService) ListRevisions(ctx context.Context, pollID primitive.ObjectID) ([]Revision, error) {
+	cursor, err := s.revisionCollection.Find(ctx, bson.M{"poll_id": pollID},
+		options.Find().SetSort(bson.D{{Key: "number", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []Revision{}
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
@@ -0,0 +1,54 @@
+package poll
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEditApply(t *testing.T) {
+	a := Option{ID: primitive.NewObjectID(), Text: "Tacos"}
+	b := Option{ID: primitive.NewObjectID(), Text: "Pizza"}
+	fresh := &Poll{Question: "Lunch?", Options: []Option{a, b}}
+	voted := &Poll{Question: "Lunch?", Options: []Option{{ID: a.ID, Text: a.Text, Count: 2}, b}, VoteCount: 2}
+	question := "Lunch on Friday?"
+	recased := "  lunch? "
+
+	cases := map[string]struct {
+		poll *Poll
+		edit Edit
+		want error
+	}{
+		"retitle":               {fresh, Edit{Question: &question}, nil},
+		"empty question":        {fresh, Edit{Question: new(string)}, ErrInvalidEdit},
+		"reorder and add":       {fresh, Edit{Options: []OptionEdit{{ID: b.ID, Text: "Pizza"}, {ID: a.ID, Text: "Tacos"}, {Text: "Sushi"}}}, nil},
+		"no options":            {fresh, Edit{Options: []OptionEdit{}}, ErrInvalidEdit},
+		"unknown option":        {fresh, Edit{Options: []OptionEdit{{ID: primitive.NewObjectID(), Text: "Soup"}}}, ErrInvalidOption},
+		"option twice":          {fresh, Edit{Options: []OptionEdit{{ID: a.ID, Text: "Tacos"}, {ID: a.ID, Text: "Tacos"}}}, ErrInvalidOption},
+		"remove before votes":   {fresh, Edit{Options: []OptionEdit{{ID: b.ID, Text: "Pizza"}}}, nil},
+		"remove voted option":   {voted, Edit{Options: []OptionEdit{{ID: b.ID, Text: "Pizza"}}}, ErrOptionHasVotes},
+		"rename voted option":   {voted, Edit{Options: []OptionEdit{{ID: a.ID, Text: "Burritos"}, {ID: b.ID, Text: "Pizza"}}}, ErrOptionHasVotes},
+		"rename unvoted option": {voted, Edit{Options: []OptionEdit{{ID: a.ID, Text: "Tacos"}, {ID: b.ID, Text: "Pasta"}}}, nil},
+		"remove unvoted option": {voted, Edit{Options: []OptionEdit{{ID: a.ID, Text: "Tacos"}, {Text: "Sushi"}}}, nil},
+		"retitle after votes":   {voted, Edit{Question: &question}, ErrQuestionHasVotes},
+		"recase after votes":    {voted, Edit{Question: &recased}, nil},
+	}
+	for name, c := range cases {
+		if _, _, err := c.edit.apply(c.poll); err != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, err)
+		}
+	}
+}
+
+func TestEditApplyKeepsCounts(t *testing.T) {
+	a := Option{ID: primitive.NewObjectID(), Text: "Tacos", Count: 3}
+	p := &Poll{Question: "Lunch?", Options: []Option{a}}
+
+	_, opts, err := (&Edit{Options: []OptionEdit{{Text: "Sushi"}, {ID: a.ID, Text: "Tacos"}}}).apply(p)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(opts) != 2 || opts[1].ID != a.ID || opts[1].Count != 3 || opts[0].Count != 0 {
+		t.Errorf("expected the new option first and the votes kept; got %+v", opts)
+	}
+}
@@ -0,0 +1,34 @@
+package poll
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ApplySchedules opens the polls whose start has come and closes those whose
+// end has passed. The updates select polls by their state, not by what
+// changed since the last run, so a run after a restart catches up on
+// everything that was missed. Several instances may run it at once: a poll
+// only matches until one of them has updated it.
+func (s *PollService) ApplySchedules(ctx context.Context, now time.Time) error {
+	_, err := s.pollCollection.UpdateMany(ctx,
+		bson.M{"active": true, "ends_at": bson.M{"$lte": now}, "deleted_at": notDeleted},
+		bson.M{"$set": bson.M{"active": false, "closed_at": now}})
+	if err != nil {
+		return err
+	}
+
+	// A poll its creator closed stays closed when its start comes
+	_, err = s.pollCollection.UpdateMany(ctx,
+		bson.M{
+			"active":     false,
+			"closed_at":  bson.M{"$exists": false},
+			"starts_at":  bson.M{"$lte": now},
+			"ends_at":    bson.M{"$not": bson.M{"$lte": now}},
+			"deleted_at": notDeleted,
+		},
+		bson.M{"$set": bson.M{"active": true}})
+	return err
+}
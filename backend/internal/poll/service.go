@@ -13,21 +13,62 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrPollNotFound     = errors.New("Poll not found")
+	ErrVotingNotStarted = errors.New("Voting on this poll has not started yet")
+	ErrVotingEnded      = errors.New("Voting on this poll has ended")
+	ErrPollClosed       = errors.New("This poll is closed and no longer accepts votes")
+	ErrInvalidOption    = errors.New("Invalid option ID")
+)
+
 type PollService struct {
 	pollCollection *mongo.Collection
+	revisionCollection *mongo.Collection
 	voteService    *vote.VoteService
     userService    *user.UserService
+	restoreWindow  time.Duration
 }
 
-func NewPollService(db *mongo.Database, voteService *vote.VoteService, userService *user.UserService) *PollService {
+func NewPollService(db *mongo.Database, voteService *vote.VoteService, userService *user.UserService, restoreWindow time.Duration) *PollService {
 	return &PollService{
 		pollCollection: db.Collection("polls"),
+		revisionCollection: db.Collection("poll_revisions"),
 		voteService:    voteService,
         userService:    userService,
+		restoreWindow:  restoreWindow,
 	}
 }
 
-func (s *PollService) CreatePoll(ctx context.Context, question string, options []string, createdBy primitive.ObjectID, multipleChoices bool) (*Poll, error) {
+// EnsureIndexes creates an index for each listing sort order, for filtering
+// by creator, and the text index for searching questions.
+func (s *PollService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.pollCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "vote_count", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "ends_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_by", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "question", Value: "text"}}},
+		// For the scheduler
+		{Keys: bson.D{{Key: "active", Value: 1}, {Key: "starts_at", Value: 1}}},
+		{Keys: bson.D{{Key: "active", Value: 1}, {Key: "ends_at", Value: 1}}},
+		// For purging deleted polls
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.revisionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "poll_id", Value: 1}, {Key: "number", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+func (s *PollService) CreatePoll(ctx context.Context, workspaceID primitive.ObjectID, question string, options []string, createdBy primitive.ObjectID, multipleChoices bool, startsAt, endsAt *time.Time, access Access) (*Poll, error) {
+	if err := access.normalize(); err != nil {
+		return nil, err
+	}
+
 	pollOptions := make([]Option, len(options))
 	for i, opt := range options {
 		pollOptions[i] = Option{
@@ -39,51 +80,173 @@ func (s *PollService) CreatePoll(ctx context.Context, question string, options [
 
 	poll := &Poll{
 		ID:              primitive.NewObjectID(),
+		WorkspaceID:     workspaceID,
 		Question:        question,
 		Options:         pollOptions,
 		CreatedBy:       createdBy,
 		CreatedAt:       time.Now(),
 		MultipleChoices: multipleChoices,
-		Active:          true,
+		Active:          startsAt == nil || !startsAt.After(time.Now()),
+		StartsAt:        startsAt,
+		EndsAt:          endsAt,
+		Access:          access,
 	}
 
 	_, err := s.pollCollection.InsertOne(ctx, poll)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := s.revisionCollection.InsertOne(ctx, newRevision(poll, createdBy, poll.CreatedAt)); err != nil {
+		return nil, err
+	}
 
-    user, err := s.userService.GetUser(createdBy)
-    if err != nil {
-        return nil, err
-    }
+	if err := s.userService.AddCreatedPolls(ctx, createdBy, []primitive.ObjectID{poll.ID}); err != nil {
+		return nil, err
+	}
 
-    user.CreatedPolls = append(user.CreatedPolls, poll.ID)
+	return poll, nil
+}
 
-    err = s.userService.UpdateUser(user)
-    if err != nil {
-        return nil, err
-    }
+func (s *PollService) GetPoll(ctx context.Context, pollID primitive.ObjectID) (*Poll, error) {
+	var poll Poll
+	err := s.pollCollection.FindOne(ctx, bson.M{"_id": pollID}).Decode(&poll)
+	if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+// GetPolls returns the polls with the given IDs that exist and are not
+// deleted.
+func (s *PollService) GetPolls(ctx context.Context, ids []primitive.ObjectID) ([]Poll, error) {
+	cursor, err := s.pollCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": notDeleted})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	polls := []Poll{}
+	if err = cursor.All(ctx, &polls); err != nil {
+		return nil, err
+	}
+	return polls, nil
+}
+
+// GetWorkspacePoll returns a poll only if it belongs to the workspace, so a
+// member of one workspace cannot reach another's polls by ID. Deleted polls
+// are not found.
+func (s *PollService) GetWorkspacePoll(ctx context.Context, workspaceID, pollID primitive.ObjectID) (*Poll, error) {
+	var poll Poll
+	err := s.pollCollection.FindOne(ctx, bson.M{"_id": pollID, "workspace_id": workspaceID, "deleted_at": notDeleted}).Decode(&poll)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
 
+// WorkspaceOf returns the workspace a poll that is not deleted belongs to.
+func (s *PollService) WorkspaceOf(ctx context.Context, pollID primitive.ObjectID) (primitive.ObjectID, error) {
+	var poll struct {
+		WorkspaceID primitive.ObjectID `bson:"workspace_id"`
+	}
+	err := s.pollCollection.FindOne(ctx, bson.M{"_id": pollID, "deleted_at": notDeleted},
+		options.FindOne().SetProjection(bson.M{"workspace_id": 1})).Decode(&poll)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrPollNotFound
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return poll.WorkspaceID, nil
+}
 
+// GetVisiblePoll is GetWorkspacePoll for a poll viewer may see. Polls they
+// may not see are not found, so their existence is not given away.
+func (s *PollService) GetVisiblePoll(ctx context.Context, workspaceID, pollID primitive.ObjectID, viewer *user.User) (*Poll, error) {
+	poll, err := s.GetWorkspacePoll(ctx, workspaceID, pollID)
+	if err != nil {
+		return nil, err
+	}
+	if !poll.VisibleTo(viewer) {
+		return nil, ErrPollNotFound
+	}
 	return poll, nil
 }
 
-func (s *PollService) GetPoll(ctx context.Context, pollID primitive.ObjectID) (*Poll, error) {
+// SetAccess changes a poll's visibility and invite list and returns it as
+// updated.
+func (s *PollService) SetAccess(ctx context.Context, workspaceID, pollID primitive.ObjectID, access Access) (*Poll, error) {
+	if err := access.normalize(); err != nil {
+		return nil, err
+	}
+
 	var poll Poll
-	err := s.pollCollection.FindOne(ctx, bson.M{"_id": pollID}).Decode(&poll)
+	err := s.pollCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": pollID, "workspace_id": workspaceID, "deleted_at": notDeleted},
+		bson.M{"$set": bson.M{
+			"visibility":     access.Visibility,
+			"invited_users":  access.InvitedUsers,
+			"invited_emails": access.InvitedEmails,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&poll)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &poll, nil
 }
 
-func (s *PollService) Vote(ctx context.Context, pollID, userID primitive.ObjectID, optionIDs []primitive.ObjectID) error {
-	poll, err := s.GetPoll(ctx, pollID)
+// SetActive closes or reopens a poll of the workspace and returns it as
+// updated. Reopening drops a start that has not come yet and an end that has
+// passed, since either would keep the poll from taking votes.
+func (s *PollService) SetActive(ctx context.Context, workspaceID, pollID primitive.ObjectID, active bool) (*Poll, error) {
+	now := time.Now()
+	var update interface{} = mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"active":    true,
+			"starts_at": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$starts_at", now}}, "$$REMOVE", "$starts_at"}},
+			"ends_at":   bson.M{"$cond": bson.A{bson.M{"$lte": bson.A{"$ends_at", now}}, "$$REMOVE", "$ends_at"}},
+		}}},
+		{{Key: "$unset", Value: "closed_at"}},
+	}
+	if !active {
+		update = bson.M{"$set": bson.M{"active": false, "closed_at": now}}
+	}
+
+	var poll Poll
+	err := s.pollCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": pollID, "workspace_id": workspaceID, "deleted_at": notDeleted},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&poll)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPollNotFound
+	}
 	if err != nil {
+		return nil, err
+	}
+	return &poll, nil
+}
+
+func (s *PollService) Vote(ctx context.Context, workspaceID, pollID primitive.ObjectID, voter *user.User, optionIDs []primitive.ObjectID) error {
+	poll, err := s.GetVisiblePoll(ctx, workspaceID, pollID, voter)
+	if err != nil {
+		return err
+	}
+	if err := poll.CheckOpen(time.Now()); err != nil {
 		return err
 	}
 
 	// Validate option IDs
+	if len(optionIDs) == 0 {
+		return ErrInvalidOption
+	}
 	validOptionIDs := make(map[primitive.ObjectID]bool)
 	for _, opt := range poll.Options {
 		validOptionIDs[opt.ID] = true
@@ -91,7 +254,7 @@ func (s *PollService) Vote(ctx context.Context, pollID, userID primitive.ObjectI
 
 	for _, optionID := range optionIDs {
 		if !validOptionIDs[optionID] {
-			return errors.New("invalid option ID")
+			return ErrInvalidOption
 		}
 	}
 
@@ -100,7 +263,7 @@ func (s *PollService) Vote(ctx context.Context, pollID, userID primitive.ObjectI
 	}
 
 	// Use VoteService to add the vote
-	err = s.voteService.AddVote(ctx, pollID, userID, optionIDs)
+	err = s.voteService.AddVote(ctx, pollID, voter.ID, optionIDs)
 	if err != nil {
 		return err
 	}
@@ -109,12 +272,15 @@ func (s *PollService) Vote(ctx context.Context, pollID, userID primitive.ObjectI
 	update := bson.M{
 		"$inc": bson.M{
 			"options.$[elem].count": 1,
+			"vote_count":            1,
 		},
 	}
 
-	_, err = s.pollCollection.UpdateOne(
+	// The options must still be there: an edit may have removed one since
+	// the poll was read
+	res, err := s.pollCollection.UpdateOne(
 		ctx,
-		bson.M{"_id": pollID},
+		bson.M{"_id": pollID, "options._id": bson.M{"$all": optionIDs}},
 		update,
 		options.Update().SetArrayFilters(
 			options.ArrayFilters{
@@ -128,6 +294,193 @@ func (s *PollService) Vote(ctx context.Context, pollID, userID primitive.ObjectI
 	if err != nil {
 		return err
 	}
+	if res.MatchedCount == 0 {
+		if err := s.voteService.RemoveVote(ctx, pollID, voter.ID); err != nil {
+			return err
+		}
+		return ErrInvalidOption
+	}
 
 	return nil
 }
+
+// ListPolls returns a page of the polls that are not deleted, newest first,
+// and their total count.
+func (s *PollService) ListPolls(ctx context.Context, skip, limit int64) ([]Poll, int64, error) {
+	filter := bson.M{"deleted_at": notDeleted}
+	total, err := s.pollCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := s.pollCollection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	polls := []Poll{}
+	if err = cursor.All(ctx, &polls); err != nil {
+		return nil, 0, err
+	}
+	return polls, total, nil
+}
+
+// SearchPolls returns the page of polls q asks for and the cursor for the
+// next page, which is nil on the last one.
+func (s *PollService) SearchPolls(ctx context.Context, q Query) ([]Poll, *Cursor, error) {
+	cursor, err := s.pollCollection.Find(ctx, q.filter(time.Now()), options.Find().
+		SetSort(q.order()).
+		SetLimit(q.Limit+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	polls := []Poll{}
+	if err = cursor.All(ctx, &polls); err != nil {
+		return nil, nil, err
+	}
+
+	// One extra poll was fetched to tell whether there is another page
+	if int64(len(polls)) <= q.Limit {
+		return polls, nil, nil
+	}
+	polls = polls[:q.Limit]
+	return polls, newCursor(q.Sort, &polls[len(polls)-1]), nil
+}
+
+// BackfillVoteCounts sets vote_count on polls from before it was kept.
+func (s *PollService) BackfillVoteCounts(ctx context.Context) error {
+	cursor, err := s.pollCollection.Find(ctx, bson.M{"vote_count": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var p Poll
+		if err := cursor.Decode(&p); err != nil {
+			return err
+		}
+		n, err := s.voteService.CountVotesForPoll(ctx, p.ID)
+		if err != nil {
+			return err
+		}
+		_, err = s.pollCollection.UpdateOne(ctx,
+			bson.M{"_id": p.ID, "vote_count": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"vote_count": n}})
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// AdoptUnassignedPolls moves polls created before workspaces existed into
+// workspaceID. It returns how many it moved.
+func (s *PollService) AdoptUnassignedPolls(ctx context.Context, workspaceID primitive.ObjectID) (int64, error) {
+	result, err := s.pollCollection.UpdateMany(ctx,
+		bson.M{"workspace_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"workspace_id": workspaceID}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// HasUnassignedPolls reports whether any poll predates workspaces.
+func (s *PollService) HasUnassignedPolls(ctx context.Context) (bool, error) {
+	n, err := s.pollCollection.CountDocuments(ctx,
+		bson.M{"workspace_id": bson.M{"$exists": false}},
+		options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// ListPollsByCreator returns every poll the user created, oldest first.
+func (s *PollService) ListPollsByCreator(ctx context.Context, userID primitive.ObjectID) ([]Poll, error) {
+	cursor, err := s.pollCollection.Find(ctx, bson.M{"created_by": userID},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	polls := []Poll{}
+	if err = cursor.All(ctx, &polls); err != nil {
+		return nil, err
+	}
+	return polls, nil
+}
+
+// DeletePoll removes a poll together with its ballots, its revisions and its
+// entry in the creator's CreatedPolls. The poll itself goes last, so a
+// deletion that fails halfway can be retried.
+func (s *PollService) DeletePoll(ctx context.Context, poll *Poll) error {
+	if err := s.voteService.DeleteVotesForPoll(ctx, poll.ID); err != nil {
+		return err
+	}
+	if _, err := s.revisionCollection.DeleteMany(ctx, bson.M{"poll_id": poll.ID}); err != nil {
+		return err
+	}
+	if err := s.userService.RemoveCreatedPoll(ctx, poll.CreatedBy, poll.ID); err != nil {
+		return err
+	}
+	_, err := s.pollCollection.DeleteOne(ctx, bson.M{"_id": poll.ID})
+	return err
+}
+
+// TransferPolls hands every poll created by from over to to.
+func (s *PollService) TransferPolls(ctx context.Context, from, to primitive.ObjectID) (int64, error) {
+	polls, err := s.ListPollsByCreator(ctx, from)
+	if err != nil || len(polls) == 0 {
+		return 0, err
+	}
+
+	ids := make([]primitive.ObjectID, len(polls))
+	for i, p := range polls {
+		ids[i] = p.ID
+	}
+
+	// Record the new owner first, so a failure halfway leaves the polls
+	// listed under both users rather than neither.
+	if err := s.userService.AddCreatedPolls(ctx, to, ids); err != nil {
+		return 0, err
+	}
+	result, err := s.pollCollection.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "created_by": from},
+		bson.M{"$set": bson.M{"created_by": to}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// RetractVotes deletes the user's ballots and takes them off the tallies of
+// the polls they were cast on.
+func (s *PollService) RetractVotes(ctx context.Context, userID primitive.ObjectID) (int, error) {
+	votes, err := s.voteService.RemoveVotesByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, v := range votes {
+		_, err = s.pollCollection.UpdateOne(ctx,
+			bson.M{"_id": v.PollID},
+			bson.M{"$inc": bson.M{"options.$[elem].count": -1, "vote_count": -1}},
+			options.Update().SetArrayFilters(options.ArrayFilters{
+				Filters: []interface{}{bson.M{"elem._id": bson.M{"$in": v.OptionIDs}}},
+			}),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(votes), nil
+}
@@ -0,0 +1,114 @@
+package poll
+
+import (
+	"errors"
+	"net/mail"
+	"slices"
+	"strings"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidAccess = errors.New("Visibility must be public, unlisted or private, and invited emails must be valid addresses")
+
+// Visibility decides who in a poll's workspace can find and reach it. The
+// workspace is always the outer boundary: inviting someone to a private poll
+// does not let them into the workspace.
+type Visibility string
+
+const (
+	// VisibilityPublic polls are listed to every member.
+	VisibilityPublic Visibility = "public"
+	// VisibilityUnlisted polls are not listed, but any member with the link
+	// can view them and vote.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPrivate polls are only for their creator and the users and
+	// email addresses they invited.
+	VisibilityPrivate Visibility = "private"
+)
+
+// Valid reports whether v is one of the known visibilities.
+func (v Visibility) Valid() bool {
+	return v == VisibilityPublic || v == VisibilityUnlisted || v == VisibilityPrivate
+}
+
+// Access is a poll's visibility and, for private polls, its invite list.
+// Polls from before visibilities existed have none and count as public.
+type Access struct {
+	Visibility    Visibility           `bson:"visibility,omitempty" json:"visibility"`
+	InvitedUsers  []primitive.ObjectID `bson:"invited_users,omitempty" json:"invited_users,omitempty"`
+	InvitedEmails []string             `bson:"invited_emails,omitempty" json:"invited_emails,omitempty"`
+}
+
+// equal reports whether a and b let the same people see the poll. Polls
+// with no visibility count as public.
+func (a Access) equal(b Access) bool {
+	visibility := func(v Visibility) Visibility {
+		if v == "" {
+			return VisibilityPublic
+		}
+		return v
+	}
+	return visibility(a.Visibility) == visibility(b.Visibility) &&
+		slices.Equal(a.InvitedUsers, b.InvitedUsers) &&
+		slices.Equal(a.InvitedEmails, b.InvitedEmails)
+}
+
+// normalize checks a requested access setting, defaults it to public,
+// lowercases and deduplicates the invited emails, and drops the invite list
+// from polls that are not private.
+func (a *Access) normalize() error {
+	if a.Visibility == "" {
+		a.Visibility = VisibilityPublic
+	}
+	if !a.Visibility.Valid() {
+		return ErrInvalidAccess
+	}
+	if a.Visibility != VisibilityPrivate {
+		a.InvitedUsers, a.InvitedEmails = nil, nil
+		return nil
+	}
+
+	emails := make([]string, 0, len(a.InvitedEmails))
+	for _, e := range a.InvitedEmails {
+		addr, err := mail.ParseAddress(strings.TrimSpace(e))
+		if err != nil || addr.Name != "" {
+			return ErrInvalidAccess
+		}
+		emails = append(emails, strings.ToLower(addr.Address))
+	}
+	slices.Sort(emails)
+	a.InvitedEmails = slices.Compact(emails)
+
+	users := slices.Clone(a.InvitedUsers)
+	slices.SortFunc(users, func(x, y primitive.ObjectID) int { return strings.Compare(x.Hex(), y.Hex()) })
+	a.InvitedUsers = slices.Compact(users)
+	return nil
+}
+
+// VisibleTo reports whether u may view the poll and vote on it, given that
+// u is a member of its workspace. Invited emails only count once u has
+// verified theirs.
+func (p *Poll) VisibleTo(u *user.User) bool {
+	if p.Visibility != VisibilityPrivate || p.CreatedBy == u.ID {
+		return true
+	}
+	if slices.Contains(p.InvitedUsers, u.ID) {
+		return true
+	}
+	return u.EmailVerified && slices.Contains(p.InvitedEmails, strings.ToLower(u.Email))
+}
+
+// viewFor returns the poll as u may see it: only the creator sees who was
+// invited.
+func (p *Poll) viewFor(u *user.User) *Poll {
+	view := *p
+	if view.Visibility == "" {
+		view.Visibility = VisibilityPublic
+	}
+	if p.CreatedBy != u.ID {
+		view.InvitedUsers, view.InvitedEmails = nil, nil
+	}
+	return &view
+}
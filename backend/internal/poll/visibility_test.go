@@ -0,0 +1,98 @@
+package poll
+
+import (
+	"testing"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAccessNormalize(t *testing.T) {
+	a := Access{Visibility: VisibilityPrivate, InvitedEmails: []string{" Ann@Example.com", "ann@example.com", "bob@example.com"}}
+	if err := a.normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if len(a.InvitedEmails) != 2 || a.InvitedEmails[0] != "ann@example.com" {
+		t.Errorf("expected lowercased, deduplicated emails; got %v", a.InvitedEmails)
+	}
+
+	a = Access{Visibility: VisibilityUnlisted, InvitedEmails: []string{"ann@example.com"}}
+	if err := a.normalize(); err != nil || a.InvitedEmails != nil {
+		t.Errorf("expected the invite list dropped from an unlisted poll; got %v, %v", a.InvitedEmails, err)
+	}
+
+	a = Access{}
+	if err := a.normalize(); err != nil || a.Visibility != VisibilityPublic {
+		t.Errorf("expected public by default; got %q, %v", a.Visibility, err)
+	}
+
+	for _, bad := range []Access{
+		{Visibility: "secret"},
+		{Visibility: VisibilityPrivate, InvitedEmails: []string{"not an email"}},
+		{Visibility: VisibilityPrivate, InvitedEmails: []string{"Ann <ann@example.com>"}},
+	} {
+		if err := bad.normalize(); err != ErrInvalidAccess {
+			t.Errorf("%+v: expected ErrInvalidAccess; got %v", bad, err)
+		}
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	creator := &user.User{ID: primitive.NewObjectID()}
+	invited := &user.User{ID: primitive.NewObjectID()}
+	byEmail := &user.User{ID: primitive.NewObjectID(), Email: "Ann@Example.com", EmailVerified: true}
+	unverified := &user.User{ID: primitive.NewObjectID(), Email: "ann@example.com"}
+	other := &user.User{ID: primitive.NewObjectID()}
+
+	private := &Poll{CreatedBy: creator.ID, Access: Access{
+		Visibility:    VisibilityPrivate,
+		InvitedUsers:  []primitive.ObjectID{invited.ID},
+		InvitedEmails: []string{"ann@example.com"},
+	}}
+	cases := map[string]struct {
+		poll *Poll
+		user *user.User
+		want bool
+	}{
+		"legacy":               {&Poll{}, other, true},
+		"unlisted":             {&Poll{Access: Access{Visibility: VisibilityUnlisted}}, other, true},
+		"private, creator":     {private, creator, true},
+		"private, invited":     {private, invited, true},
+		"private, by email":    {private, byEmail, true},
+		"private, unverified":  {private, unverified, false},
+		"private, not invited": {private, other, false},
+	}
+	for name, c := range cases {
+		if got := c.poll.VisibleTo(c.user); got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+
+	if view := private.viewFor(invited); view.InvitedUsers != nil || view.InvitedEmails != nil {
+		t.Errorf("expected the invite list hidden from invitees; got %+v", view.Access)
+	}
+	if view := private.viewFor(creator); len(view.InvitedUsers) != 1 {
+		t.Errorf("expected the creator to see the invite list; got %+v", view.Access)
+	}
+}
+
+func TestAccessEqual(t *testing.T) {
+	ann := primitive.NewObjectID()
+	private := Access{Visibility: VisibilityPrivate, InvitedUsers: []primitive.ObjectID{ann}, InvitedEmails: []string{"ann@example.com"}}
+	cases := map[string]struct {
+		a, b Access
+		want bool
+	}{
+		"same":                {private, Access{Visibility: VisibilityPrivate, InvitedUsers: []primitive.ObjectID{ann}, InvitedEmails: []string{"ann@example.com"}}, true},
+		"legacy and public":   {Access{}, Access{Visibility: VisibilityPublic}, true},
+		"visibility changed":  {Access{Visibility: VisibilityPublic}, Access{Visibility: VisibilityUnlisted}, false},
+		"user uninvited":      {private, Access{Visibility: VisibilityPrivate, InvitedEmails: []string{"ann@example.com"}}, false},
+		"email invited":       {private, Access{Visibility: VisibilityPrivate, InvitedUsers: []primitive.ObjectID{ann}, InvitedEmails: []string{"ann@example.com", "bob@example.com"}}, false},
+		"empty and nil lists": {Access{Visibility: VisibilityPrivate, InvitedEmails: []string{}}, Access{Visibility: VisibilityPrivate}, true},
+	}
+	for name, c := range cases {
+		if got := c.a.equal(c.b); got != c.want {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/config"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/go-webauthn/webauthn/metadata/providers/memory"
+	"github.com/google/uuid"
+)
+
+// newAttestationPolicy builds the attestation policy from configuration,
+// along with the metadata provider go-webauthn verifies attestation
+// statements against. The provider is nil without a metadata blob.
+func newAttestationPolicy(cfg config.AttestationPolicyConfig) (*user.AttestationPolicy, metadata.Provider, error) {
+	policy := &user.AttestationPolicy{
+		AllowAAGUIDs: parseAAGUIDs(cfg.AllowAAGUIDs),
+		DenyAAGUIDs:  parseAAGUIDs(cfg.DenyAAGUIDs),
+		Roles:        map[user.Role]user.AttestationRequirement{},
+	}
+	for role, req := range cfg.Roles {
+		policy.Roles[user.Role(role)] = user.AttestationRequirement{
+			RequireAttestation: req.RequireAttestation,
+			AllowAAGUIDs:       parseAAGUIDs(req.AllowAAGUIDs),
+		}
+	}
+	if cfg.MDSFile == "" {
+		return policy, nil, nil
+	}
+
+	entries, nextUpdate, err := user.LoadMetadata(cfg.MDSFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(nextUpdate) {
+		log.Printf("Metadata blob %s was due for an update on %s", cfg.MDSFile, nextUpdate.Format(time.DateOnly))
+	}
+	policy.Metadata = entries
+
+	// Authenticators missing from the blob may still register; roles
+	// that need them listed say so in the policy.
+	provider, err := memory.New(
+		memory.WithMetadata(entries),
+		memory.WithValidateEntry(false),
+		memory.WithValidateTrustAnchor(true),
+		memory.WithValidateStatus(true),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	return policy, provider, nil
+}
+
+// parseAAGUIDs converts AAGUIDs that config.Validate has already checked.
+func parseAAGUIDs(values []string) []uuid.UUID {
+	aaguids := make([]uuid.UUID, 0, len(values))
+	for _, value := range values {
+		aaguids = append(aaguids, uuid.MustParse(value))
+	}
+	return aaguids
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/poll"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authenticate resolves the session or access token on the request, if
+// any, and puts the caller into the request context. Requests without a
+// valid token pass through anonymously; requireAuth and requireScope decide
+// whether that is acceptable for a given route.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := session.TokenFromRequest(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(token, user.AccessTokenPrefix) {
+			u, accessToken, err := s.userService.GetUserByAccessToken(r.Context(), token)
+			if err != nil {
+				if err != user.ErrAccessTokenNotFound {
+					log.Printf("Error resolving access token: %v", err)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := user.NewAccessTokenContext(r.Context(), accessToken)
+			ctx = user.NewContext(ctx, u)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		sess, err := s.sessionService.GetSessionByToken(r.Context(), token)
+		if err != nil {
+			if err != session.ErrInvalidSession {
+				log.Printf("Error resolving session: %v", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := session.NewContext(r.Context(), sess)
+
+		// Recovery sessions do not identify the caller; only routes wrapped
+		// in allowRecovery resolve their user.
+		if sess.IsRecovery() {
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		u, err := s.userService.GetUser(sess.UserID)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx = user.NewContext(ctx, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// allowRecovery lets a recovery session act as its user on the wrapped
+// route. It is only used for enrolling a new passkey.
+func (s *Server) allowRecovery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := session.FromContext(r.Context())
+		if !ok || !sess.IsRecovery() {
+			next(w, r)
+			return
+		}
+
+		u, err := s.userService.GetUser(sess.UserID)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(user.NewContext(r.Context(), u)))
+	}
+}
+
+// requireAuth rejects requests that did not present a valid session.
+// Access tokens are refused too: routes open to them use requireScope.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := user.FromContext(r.Context()); !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if _, ok := user.AccessTokenFromContext(r.Context()); ok {
+			http.Error(w, "Access tokens cannot be used here", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireScope accepts a signed-in session, or an access token granted
+// scope.
+func requireScope(scope user.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := user.FromContext(r.Context()); !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if t, ok := user.AccessTokenFromContext(r.Context()); ok && !t.HasScope(scope) {
+			http.Error(w, "Access token is missing scope "+string(scope), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireVerifiedEmail keeps accounts that have not confirmed their email
+// address away from the wrapped route. It must run after requireAuth.
+func requireVerifiedEmail(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := user.FromContext(r.Context()); !ok || !u.EmailVerified {
+			http.Error(w, "Email address not verified", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requirePermission rejects callers whose role does not grant p. It must run
+// after requireAuth.
+func requirePermission(p user.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := user.FromContext(r.Context()); !ok || !u.Can(p) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireMember resolves the {workspace} in the URL and lets only its
+// members through, with the workspace and their membership in the request
+// context. Everyone else gets a 404, as if the workspace did not exist. It
+// must run after requireAuth or requireScope.
+func (s *Server) requireMember(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := user.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ws, member, err := s.workspaceService.Membership(r.Context(), mux.Vars(r)["workspace"], u.ID)
+		if err == workspace.ErrWorkspaceNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next(w, r.WithContext(workspace.NewContext(r.Context(), ws, member)))
+	}
+}
+
+// requirePollMember is requireMember for routes that name a poll by its {id}
+// alone, as the links shared before workspaces did. The workspace is the
+// poll's own, and polls in workspaces the caller is not a member of are not
+// found.
+func (s *Server) requirePollMember(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, ok := user.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		pollID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+			return
+		}
+
+		workspaceID, err := s.pollService.WorkspaceOf(r.Context(), pollID)
+		if err == poll.ErrPollNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ws, member, err := s.workspaceService.MembershipByID(r.Context(), workspaceID, u.ID)
+		if err == workspace.ErrWorkspaceNotFound {
+			http.Error(w, poll.ErrPollNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next(w, r.WithContext(workspace.NewContext(r.Context(), ws, member)))
+	}
+}
+
+// reauthenticationRequired is the body of the 403 sent by requireFreshAuth.
+// The client should run the step-up ceremony at the given endpoints and then
+// retry the request.
+type reauthenticationRequired struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Begin   string `json:"begin"`
+	Finish  string `json:"finish"`
+}
+
+// requireFreshAuth keeps sensitive routes for sessions whose user signed in
+// or re-authenticated within the last few minutes. A recovery session counts
+// as fresh, since redeeming the code just proved who it is, and it only gets
+// this far on routes wrapped in allowRecovery. It must run after requireAuth.
+func requireFreshAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sess, ok := session.FromContext(r.Context()); !ok || !(sess.IsFresh() || sess.IsRecovery()) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(reauthenticationRequired{
+				Error:   "reauthentication_required",
+				Message: "Confirm it's you with your passkey to continue",
+				Begin:   "/reauth/begin",
+				Finish:  "/reauth/finish",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
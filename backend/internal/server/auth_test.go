@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRequireAuthAndScope(t *testing.T) {
+	caller := &user.User{ID: primitive.NewObjectID()}
+	pollsWrite := &user.AccessToken{Scopes: []user.Scope{user.ScopePollsWrite}}
+
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+		user    *user.User
+		token   *user.AccessToken
+		want    int
+	}{
+		{"auth anonymous", requireAuth(okHandler), nil, nil, http.StatusUnauthorized},
+		{"auth session", requireAuth(okHandler), caller, nil, http.StatusOK},
+		{"auth access token", requireAuth(okHandler), caller, pollsWrite, http.StatusForbidden},
+		{"scope anonymous", requireScope(user.ScopePollsWrite, okHandler), nil, nil, http.StatusUnauthorized},
+		{"scope session", requireScope(user.ScopeVotesWrite, okHandler), caller, nil, http.StatusOK},
+		{"scope granted", requireScope(user.ScopePollsWrite, okHandler), caller, pollsWrite, http.StatusOK},
+		{"scope missing", requireScope(user.ScopeVotesWrite, okHandler), caller, pollsWrite, http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		ctx := r.Context()
+		if c.user != nil {
+			ctx = user.NewContext(ctx, c.user)
+		}
+		if c.token != nil {
+			ctx = user.NewAccessTokenContext(ctx, c.token)
+		}
+		w := httptest.NewRecorder()
+
+		c.handler(w, r.WithContext(ctx))
+		if w.Code != c.want {
+			t.Errorf("%s: expected status %d; got %d", c.name, c.want, w.Code)
+		}
+	}
+}
+
+func TestRequireFreshAuth(t *testing.T) {
+	cases := []struct {
+		name    string
+		session *session.Session
+		want    int
+	}{
+		{"no session", nil, http.StatusForbidden},
+		{"stale", &session.Session{FreshUntil: time.Now().Add(-time.Second)}, http.StatusForbidden},
+		{"fresh", &session.Session{FreshUntil: time.Now().Add(time.Minute)}, http.StatusOK},
+		{"recovery", &session.Session{Scope: session.ScopeRecovery}, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodDelete, "/", nil)
+		if c.session != nil {
+			r = r.WithContext(session.NewContext(r.Context(), c.session))
+		}
+		w := httptest.NewRecorder()
+
+		requireFreshAuth(okHandler)(w, r)
+		if w.Code != c.want {
+			t.Errorf("%s: expected status %d; got %d", c.name, c.want, w.Code)
+			continue
+		}
+		if w.Code == http.StatusForbidden {
+			var body reauthenticationRequired
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Error != "reauthentication_required" {
+				t.Errorf("%s: expected a reauthentication_required body; got %q (%v)", c.name, w.Body.String(), err)
+			}
+		}
+	}
+}
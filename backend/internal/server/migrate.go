@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"log"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
+)
+
+// legacyWorkspaceSlug names the workspace that polls from before workspaces
+// are moved into.
+const legacyWorkspaceSlug = "general"
+
+// adoptLegacyPolls moves polls without a workspace into the legacy one.
+// Everyone could see those polls, so every account that exists at that point
+// joins it, with admins as its owners. Without an admin the oldest account
+// owns it, so someone can always invite the accounts registered later.
+// Running it again, or on several instances at once, is harmless.
+func (s *Server) adoptLegacyPolls(ctx context.Context) error {
+	legacy, err := s.pollService.HasUnassignedPolls(ctx)
+	if err != nil || !legacy {
+		return err
+	}
+
+	ws, err := s.workspaceService.EnsureWorkspace(ctx, legacyWorkspaceSlug, "General")
+	if err != nil {
+		return err
+	}
+	users, err := s.userService.ListRegisteredUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for i, role := range legacyRoles(users) {
+		if err := s.workspaceService.AddMember(ctx, ws.ID, users[i].ID, role); err != nil {
+			return err
+		}
+	}
+
+	moved, err := s.pollService.AdoptUnassignedPolls(ctx, ws.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("Moved %d polls into the %q workspace for its %d members", moved, legacyWorkspaceSlug, len(users))
+	return nil
+}
+
+// legacyRoles gives users, oldest first, their roles in the legacy
+// workspace: owner for admins, or for the oldest account if there is no
+// admin, and member for everyone else.
+func legacyRoles(users []user.User) []workspace.Role {
+	roles := make([]workspace.Role, len(users))
+	owner := false
+	for i := range users {
+		roles[i] = workspace.RoleMember
+		if users[i].EffectiveRole() == user.RoleAdmin {
+			roles[i] = workspace.RoleOwner
+			owner = true
+		}
+	}
+	if !owner && len(roles) > 0 {
+		roles[0] = workspace.RoleOwner
+	}
+	return roles
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
+)
+
+func TestLegacyRoles(t *testing.T) {
+	owner, member := workspace.RoleOwner, workspace.RoleMember
+
+	cases := map[string]struct {
+		users []user.User
+		want  []workspace.Role
+	}{
+		"no accounts":    {nil, []workspace.Role{}},
+		"admins own it":  {[]user.User{{}, {Role: user.RoleAdmin}, {Role: user.RoleAdmin}}, []workspace.Role{member, owner, owner}},
+		"oldest owns it": {[]user.User{{}, {Role: user.RoleModerator}, {}}, []workspace.Role{owner, member, member}},
+	}
+	for name, c := range cases {
+		if got := legacyRoles(c.users); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: expected %v; got %v", name, c.want, got)
+		}
+	}
+}
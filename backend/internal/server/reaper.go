@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// reapPendingRegistrations periodically deletes users who started a
+// registration but never stored a passkey, until ctx is cancelled. Deleting
+// by age is idempotent, so every instance can run it.
+func (s *Server) reapPendingRegistrations(ctx context.Context, window time.Duration) {
+	interval := min(window/2, 10*time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deleted, err := s.userService.DeletePendingUsers(ctx, time.Now().Add(-window))
+			if err != nil {
+				log.Printf("Error reaping pending registrations: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Printf("Reaped %d abandoned registrations", deleted)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
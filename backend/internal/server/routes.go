@@ -5,8 +5,10 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/poll"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/account"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/admin"
 	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
 	"github.com/gorilla/mux"
 )
 
@@ -14,24 +16,101 @@ import (
 
 func (s *Server) RegisterRoutes() http.Handler {
 	mux := mux.NewRouter()
+	mux.Use(s.proxies.Middleware, s.authenticate)
 
 
 	// Hello World Route (for testing)
 	mux.HandleFunc("/", s.HelloWorldHandler)
 
-	userHandler := user.NewUserHandler(s.userService, s.webAuthn, s.db)
+	userHandler := user.NewUserHandler(s.userService, s.sessionService, s.webAuthn, s.ceremonies, s.verifier, s.limiter, s.auditService, user.HandlerOptions{
+		ClonePolicy:    user.ClonePolicy(s.config.WebAuthn.ClonePolicy),
+		Attestation:    s.attestation,
+		BootstrapAdmin: s.config.BootstrapAdminEmail,
+		DecoyKey:       []byte(s.config.Session.Secret),
+		SecureCookies:  *s.config.Session.CookieSecure,
+	})
 	
 	mux.HandleFunc("/register/begin", userHandler.BeginRegistration)  
 	mux.HandleFunc("/register/finish", userHandler.FinishRegistration) 
 	mux.HandleFunc("/login/begin", userHandler.BeginLogin)             
 	mux.HandleFunc("/login/finish", userHandler.FinishLogin) 
-	mux.HandleFunc("/auth/verify", userHandler.VerifyCredentials)     
+	mux.HandleFunc("/login/discoverable/begin", userHandler.BeginDiscoverableLogin)
+	mux.HandleFunc("/login/discoverable/finish", userHandler.FinishDiscoverableLogin)
+	mux.HandleFunc("/auth/verify", userHandler.VerifyCredentials)
+
+	mux.HandleFunc("/credentials", requireAuth(userHandler.ListCredentials)).Methods("GET")
+	mux.HandleFunc("/credentials/begin", s.allowRecovery(requireAuth(requireFreshAuth(userHandler.BeginAddCredential)))).Methods("POST")
+	mux.HandleFunc("/credentials/finish", s.allowRecovery(requireAuth(requireFreshAuth(userHandler.FinishAddCredential)))).Methods("POST")
+	mux.HandleFunc("/credentials/{id}", requireAuth(userHandler.RenameCredential)).Methods("PATCH")
+	mux.HandleFunc("/credentials/{id}", requireAuth(requireFreshAuth(userHandler.RevokeCredential))).Methods("DELETE")
+
+	mux.HandleFunc("/recovery-codes", requireAuth(requireFreshAuth(userHandler.RegenerateRecoveryCodes))).Methods("POST")
+	mux.HandleFunc("/recovery/redeem", userHandler.RedeemRecoveryCode).Methods("POST")
+
+	mux.HandleFunc("/email/verify", userHandler.VerifyEmail).Methods("POST")
+	mux.HandleFunc("/email/verify/resend", requireAuth(userHandler.ResendVerification)).Methods("POST")
+
+	mux.HandleFunc("/profile", requireAuth(userHandler.GetProfile)).Methods("GET")
+	mux.HandleFunc("/profile", requireAuth(userHandler.UpdateProfile)).Methods("PATCH")
+	mux.HandleFunc("/profile/email", requireAuth(requireFreshAuth(userHandler.ChangeEmail))).Methods("POST")
+
+	mux.HandleFunc("/tokens", requireAuth(userHandler.ListAccessTokens)).Methods("GET")
+	mux.HandleFunc("/tokens", requireAuth(requireFreshAuth(userHandler.CreateAccessToken))).Methods("POST")
+	mux.HandleFunc("/tokens/{id}", requireAuth(userHandler.RevokeAccessToken)).Methods("DELETE")
+
+	mux.HandleFunc("/sessions", requireAuth(userHandler.ListSessions)).Methods("GET")
+	mux.HandleFunc("/sessions", requireAuth(userHandler.RevokeAllSessions)).Methods("DELETE")
+	mux.HandleFunc("/sessions/{id}", requireAuth(userHandler.RevokeSession)).Methods("DELETE")
+	mux.HandleFunc("/logout", userHandler.Logout).Methods("POST")
+	mux.HandleFunc("/reauth/begin", requireAuth(userHandler.BeginReauthentication)).Methods("POST")
+	mux.HandleFunc("/reauth/finish", requireAuth(userHandler.FinishReauthentication)).Methods("POST")     
 	
-	pollHandler := poll.NewPollHandler(s.pollService)
-	mux.HandleFunc("/polls/{id}", pollHandler.GetPoll).Methods("GET")
-	mux.HandleFunc("/polls", pollHandler.CreatePoll).Methods("POST")
-	mux.HandleFunc("/polls/{id}/vote", pollHandler.Vote).Methods("POST")
-	mux.HandleFunc("/polls/{id}/stream", pollHandler.StreamPollUpdates).Methods("GET")
+	accountService := account.NewAccountService(s.userService, s.pollService, s.voteService, s.sessionService, s.workspaceService)
+	accountHandler := account.NewAccountHandler(accountService, s.userService, s.auditService, *s.config.Session.CookieSecure)
+	mux.HandleFunc("/account/export", requireAuth(requireFreshAuth(accountHandler.ExportAccount))).Methods("GET")
+	mux.HandleFunc("/account", requireAuth(requireFreshAuth(accountHandler.DeleteAccount))).Methods("DELETE")
+
+	workspaceHandler := workspace.NewWorkspaceHandler(s.workspaceService, s.auditService)
+	mux.HandleFunc("/workspaces", requireAuth(workspaceHandler.ListWorkspaces)).Methods("GET")
+	mux.HandleFunc("/workspaces", requireAuth(requireVerifiedEmail(workspaceHandler.CreateWorkspace))).Methods("POST")
+	mux.HandleFunc("/workspaces/{workspace}", requireAuth(s.requireMember(workspaceHandler.GetWorkspace))).Methods("GET")
+	mux.HandleFunc("/workspaces/{workspace}/members", requireAuth(s.requireMember(workspaceHandler.ListMembers))).Methods("GET")
+	mux.HandleFunc("/workspaces/{workspace}/members/{userId}", requireAuth(s.requireMember(workspaceHandler.RemoveMember))).Methods("DELETE")
+	mux.HandleFunc("/workspaces/{workspace}/invitations", requireAuth(s.requireMember(workspaceHandler.ListInvitations))).Methods("GET")
+	mux.HandleFunc("/workspaces/{workspace}/invitations", requireAuth(s.requireMember(workspaceHandler.Invite))).Methods("POST")
+	mux.HandleFunc("/workspaces/{workspace}/invitations/{id}", requireAuth(s.requireMember(workspaceHandler.RevokeInvitation))).Methods("DELETE")
+	mux.HandleFunc("/invitations/accept", requireAuth(requireVerifiedEmail(workspaceHandler.AcceptInvitation))).Methods("POST")
+
+	mux.HandleFunc("/polls", requireScope(user.ScopePollsRead, s.pollHandler.ListPolls)).Methods("GET")
+	mux.HandleFunc("/workspaces/{workspace}/polls", requireScope(user.ScopePollsRead, s.requireMember(s.pollHandler.ListPolls))).Methods("GET")
+	mux.HandleFunc("/workspaces/{workspace}/polls", requireScope(user.ScopePollsWrite, requireVerifiedEmail(s.requireMember(s.pollHandler.CreatePoll)))).Methods("POST")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}", requireScope(user.ScopePollsRead, s.requireMember(s.pollHandler.GetPoll))).Methods("GET")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}", requireScope(user.ScopePollsWrite, s.requireMember(s.pollHandler.EditPoll))).Methods("PATCH")
+	// Deleting takes a fresh passkey login, which access tokens cannot give,
+	// so they are refused outright rather than sent to /reauth
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}", requireAuth(requireFreshAuth(s.requireMember(s.pollHandler.DeletePoll)))).Methods("DELETE")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}/restore", requireScope(user.ScopePollsWrite, s.requireMember(s.pollHandler.RestorePoll))).Methods("POST")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}/visibility", requireScope(user.ScopePollsWrite, s.requireMember(s.pollHandler.SetAccess))).Methods("PUT")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}/revisions", requireScope(user.ScopePollsRead, s.requireMember(s.pollHandler.ListRevisions))).Methods("GET")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}/close", requireScope(user.ScopePollsWrite, s.requireMember(s.pollHandler.ClosePoll))).Methods("POST")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}/reopen", requireScope(user.ScopePollsWrite, s.requireMember(s.pollHandler.ReopenPoll))).Methods("POST")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}/vote", requireScope(user.ScopeVotesWrite, s.requireMember(s.pollHandler.Vote))).Methods("POST")
+	mux.HandleFunc("/workspaces/{workspace}/polls/{id}/stream", requireScope(user.ScopePollsRead, s.requireMember(s.pollHandler.StreamPollUpdates))).Methods("GET")
+
+	// Links to a poll from before workspaces keep working for its members
+	mux.HandleFunc("/polls/{id}", requireScope(user.ScopePollsRead, s.requirePollMember(s.pollHandler.GetPoll))).Methods("GET")
+	mux.HandleFunc("/polls/{id}/vote", requireScope(user.ScopeVotesWrite, s.requirePollMember(s.pollHandler.Vote))).Methods("POST")
+	mux.HandleFunc("/polls/{id}/stream", requireScope(user.ScopePollsRead, s.requirePollMember(s.pollHandler.StreamPollUpdates))).Methods("GET")
+
+	adminHandler := admin.NewAdminHandler(s.userService, s.pollService, s.auditService, s.attestation)
+	mux.HandleFunc("/admin/users", requireAuth(requirePermission(user.PermManageUsers, adminHandler.ListUsers))).Methods("GET")
+	mux.HandleFunc("/admin/users/{id}", requireAuth(requirePermission(user.PermManageUsers, adminHandler.GetUser))).Methods("GET")
+	mux.HandleFunc("/admin/users/{id}/role", requireAuth(requirePermission(user.PermManageRoles, adminHandler.SetUserRole))).Methods("PUT")
+	mux.HandleFunc("/admin/polls", requireAuth(requirePermission(user.PermModeratePolls, adminHandler.ListPolls))).Methods("GET")
+	mux.HandleFunc("/admin/polls/{id}", requireAuth(requireFreshAuth(requirePermission(user.PermModeratePolls, s.pollHandler.ModerateDelete)))).Methods("DELETE")
+	mux.HandleFunc("/admin/polls/{id}/restore", requireAuth(requirePermission(user.PermModeratePolls, s.pollHandler.ModerateRestore))).Methods("POST")
+	mux.HandleFunc("/admin/polls/{id}/close", requireAuth(requirePermission(user.PermModeratePolls, s.pollHandler.ModerateClose))).Methods("POST")
+	mux.HandleFunc("/admin/audit", requireAuth(requirePermission(user.PermViewAudit, adminHandler.ListAuditEvents))).Methods("GET")
 
 	
 	return mux
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// runPollScheduler opens and closes scheduled polls every interval until ctx
+// is cancelled. Every instance runs it; see PollService.ApplySchedules.
+func (s *Server) runPollScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.pollService.ApplySchedules(ctx, time.Now()); err != nil {
+				log.Printf("Error applying poll schedules: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purgeDeletedPolls removes deleted polls once they can no longer be
+// restored, every interval until ctx is cancelled.
+func (s *Server) purgeDeletedPolls(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			purged, err := s.pollService.PurgeDeletedPolls(ctx)
+			if err != nil {
+				log.Printf("Error purging deleted polls: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Purged %d deleted polls", purged)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,77 +1,190 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/config"
 	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/database"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/mail"
 	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/poll"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/throttle"
 	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
 	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/vote"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/workspace"
 	"github.com/go-webauthn/webauthn/webauthn"
-	_ "github.com/joho/godotenv/autoload"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Server struct {
     port        int
+    config      *config.Config
     db          *mongo.Database
     userService *user.UserService
     pollService *poll.PollService
+    voteService *vote.VoteService
+    sessionService *session.SessionService
     webAuthn    *webauthn.WebAuthn
+    ceremonies  user.CeremonyStore
+    verifier    *user.EmailVerifier
+    limiter     *throttle.Limiter
+    auditService *audit.AuditService
+    attestation *user.AttestationPolicy
+    workspaceService *workspace.WorkspaceService
+    // pollHandler is shared with the background job that tells stream
+    // clients when their poll opens or closes.
+    pollHandler *poll.PollHandler
+    proxies     session.TrustedProxies
 }
 
-func NewServer() *http.Server {
-    port, _ := strconv.Atoi(os.Getenv("PORT"))
+func NewServer(cfg *config.Config) *http.Server {
     db, err := database.New()
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
     userService := user.NewUserService(db)
     voteService := vote.NewVoteService(db)
-    pollService := poll.NewPollService(db, voteService, userService)
+    pollService := poll.NewPollService(db, voteService, userService, cfg.PollRestoreWindow.Duration)
+    sessionService := session.NewSessionService(db, []byte(cfg.Session.Secret), cfg.Session.TTL.Duration, cfg.Session.FreshAuthTTL.Duration)
+    limiter := throttle.NewLimiter(db)
+    auditService := audit.NewAuditService(db)
 
-    web, err := webauthn.New(&webauthn.Config{
-		RPDisplayName: "Your App",
-		RPID:          "localhost",
-		RPOrigins:     []string{"http://localhost:3000"},
-	})
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    if err := sessionService.EnsureIndexes(ctx); err != nil {
+        log.Fatalf("Failed to create session indexes: %v", err)
+    }
+    if err := userService.EnsureIndexes(ctx); err != nil {
+        log.Fatalf("Failed to create user indexes: %v", err)
+    }
+    if err := limiter.EnsureIndexes(ctx); err != nil {
+        log.Fatalf("Failed to create login attempt indexes: %v", err)
+    }
+    if err := auditService.EnsureIndexes(ctx); err != nil {
+        log.Fatalf("Failed to create audit indexes: %v", err)
+    }
+    if err := pollService.EnsureIndexes(ctx); err != nil {
+        log.Fatalf("Failed to create poll indexes: %v", err)
+    }
+    if err := pollService.BackfillVoteCounts(ctx); err != nil {
+        log.Fatalf("Failed to count votes on polls: %v", err)
+    }
+
+    attestation, mds, err := newAttestationPolicy(cfg.WebAuthn.AttestationPolicy)
+    if err != nil {
+        log.Fatalf("Failed to load attestation policy: %v", err)
+    }
+
+    // An admin without a passkey the admin policy accepts could never sign in
+    if existing, err := userService.GetUserByEmail(cfg.BootstrapAdminEmail); err == nil && !attestation.Satisfied(existing, user.RoleAdmin) {
+        log.Printf("Not promoting %s to admin: no passkey meets the admin attestation policy", cfg.BootstrapAdminEmail)
+    } else if promoted, err := userService.BootstrapAdmin(ctx, cfg.BootstrapAdminEmail); err != nil {
+        log.Fatalf("Failed to bootstrap admin: %v", err)
+    } else if promoted {
+        log.Printf("Promoted %s to admin from bootstrap config", cfg.BootstrapAdminEmail)
+    }
+
+    // Ceremonies live in MongoDB so begin and finish can hit different
+    // instances; the memory store is enough for a single process.
+    var ceremonies user.CeremonyStore
+    if cfg.Session.CeremonyStore == "memory" {
+        ceremonies = user.NewMemoryCeremonyStore(cfg.WebAuthn.CeremonyTTL())
+    } else {
+        mongoCeremonies := user.NewMongoCeremonyStore(db, cfg.WebAuthn.CeremonyTTL())
+        if err := mongoCeremonies.EnsureIndexes(ctx); err != nil {
+            log.Fatalf("Failed to create ceremony indexes: %v", err)
+        }
+        ceremonies = mongoCeremonies
+    }
+
+    var mailer mail.Mailer
+    if cfg.Mail.Driver == "smtp" {
+        mailer = mail.NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+    } else {
+        mailer = mail.NewLogMailer(cfg.Mail.OutboxDir)
+    }
+    verifier := user.NewEmailVerifier([]byte(cfg.Session.Secret), cfg.Mail.VerificationTTL.Duration, mailer, strings.TrimSuffix(cfg.AppURL, "/")+"/verify-email")
+    workspaceService := workspace.NewWorkspaceService(db, userService, mailer, strings.TrimSuffix(cfg.AppURL, "/")+"/invitations/accept")
+    if err := workspaceService.EnsureIndexes(ctx); err != nil {
+        log.Fatalf("Failed to create workspace indexes: %v", err)
+    }
+
+    proxies, err := session.ParseTrustedProxies(cfg.TrustedProxies)
+    if err != nil {
+        log.Fatalf("Failed to read trusted proxies: %v", err)
+    }
+
+    webAuthnConfig := cfg.WebAuthn.Options()
+    webAuthnConfig.MDS = mds
+    web, err := webauthn.New(webAuthnConfig)
     if err != nil {
         fmt.Printf("Failed to initialize WebAuthn: %v\n", err)
         os.Exit(1) // Exit if initialization fails
     }
 
     NewServer := &Server{
-        port: port,
+        port: cfg.Port,
+        config: cfg,
         db:   db,
         userService: userService,
         pollService: pollService,
+        voteService: voteService,
+        sessionService: sessionService,
         webAuthn:    web,
+        ceremonies:  ceremonies,
+        verifier:    verifier,
+        limiter:     limiter,
+        auditService: auditService,
+        attestation: attestation,
+        workspaceService: workspaceService,
+        pollHandler: poll.NewPollHandler(pollService, workspaceService, sessionService, auditService),
+        proxies:     proxies,
+    }
+
+    if err := NewServer.adoptLegacyPolls(ctx); err != nil {
+        log.Fatalf("Failed to move polls into a workspace: %v", err)
     }
 
     // Declare Server config
     server := &http.Server{
         Addr:         fmt.Sprintf(":%d", NewServer.port),
-        Handler:      corsMiddleware(NewServer.RegisterRoutes()), // Wrap the handler with CORS middleware
+        Handler:      NewServer.corsMiddleware(NewServer.RegisterRoutes()), // Wrap the handler with CORS middleware
         IdleTimeout:  5*time.Minute,
         ReadTimeout:  10 * time.Second,
         WriteTimeout: 0,
     }
 
+    // Background jobs run until the HTTP server shuts down
+    jobs, stopJobs := context.WithCancel(context.Background())
+    server.RegisterOnShutdown(stopJobs)
+    go NewServer.reapPendingRegistrations(jobs, cfg.PendingRegistrationTTL.Duration)
+    go sessionService.SweepWatched(jobs, 15*time.Second)
+    go NewServer.runPollScheduler(jobs, 5*time.Second)
+    go NewServer.purgeDeletedPolls(jobs, min(cfg.PollRestoreWindow.Duration/2, time.Hour))
+    go NewServer.pollHandler.SweepWatched(jobs, 5*time.Second)
+
     return server
 }
 
 // CORS middleware function
-func corsMiddleware(next http.Handler) http.Handler {
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        // Set CORS headers
-        w.Header().Set("Access-Control-Allow-Origin", "*") // You can change * to specific origin, e.g., "http://localhost:3000"
-        w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+        // Set CORS headers. Only the configured RP origins may call us, and
+        // they may send the session cookie along.
+        w.Header().Add("Vary", "Origin")
+        if origin := r.Header.Get("Origin"); s.config.WebAuthn.AllowsOrigin(origin) {
+            w.Header().Set("Access-Control-Allow-Origin", origin)
+            w.Header().Set("Access-Control-Allow-Credentials", "true")
+        }
+        w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
         // Handle preflight (OPTIONS) requests
         if r.Method == http.MethodOptions {
@@ -0,0 +1,52 @@
+package session
+
+import "strings"
+
+// Device gives a short human description of a user agent, like
+// "Firefox on Windows", good enough to tell a user's sessions apart.
+func Device(userAgent string) string {
+	browser := match(userAgent, []pattern{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+	})
+	os := match(userAgent, []pattern{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"CrOS", "ChromeOS"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	default:
+		return "Unknown device"
+	}
+}
+
+type pattern struct {
+	needle string
+	name   string
+}
+
+// match returns the name of the first pattern found in s. Order matters:
+// most browsers also claim to be Safari, and Android claims to be Linux.
+func match(s string, patterns []pattern) string {
+	for _, p := range patterns {
+		if strings.Contains(s, p.needle) {
+			return p.name
+		}
+	}
+	return ""
+}
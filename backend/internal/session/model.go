@@ -0,0 +1,53 @@
+package session
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ScopeRecovery marks a short-lived session opened with a recovery code. It
+// may only be used to enroll a new passkey.
+const ScopeRecovery = "recovery"
+
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Scope      string             `bson:"scope,omitempty" json:"scope,omitempty"`
+	IP         string             `bson:"ip,omitempty" json:"ip"`
+	UserAgent  string             `bson:"user_agent,omitempty" json:"user_agent"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	LastSeenAt time.Time          `bson:"last_seen_at,omitempty" json:"last_seen_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	// FreshUntil is when the last proof of the user's presence, a login or
+	// a step-up re-authentication, stops counting.
+	FreshUntil time.Time `bson:"fresh_until,omitempty" json:"fresh_until"`
+}
+
+// IsRecovery reports whether the session was opened with a recovery code.
+func (s *Session) IsRecovery() bool {
+	return s.Scope == ScopeRecovery
+}
+
+// IsFresh reports whether the user proved their presence recently enough
+// for sensitive actions.
+func (s *Session) IsFresh() bool {
+	return time.Now().Before(s.FreshUntil)
+}
+
+// View is how a session is shown to its owner.
+type View struct {
+	*Session
+	Device  string `json:"device"`
+	Current bool   `json:"current"`
+}
+
+// NewView describes s for its owner, marking it if it is the one the request
+// came in on.
+func NewView(s *Session, currentID primitive.ObjectID) View {
+	return View{
+		Session: s,
+		Device:  Device(s.UserAgent),
+		Current: s.ID == currentID,
+	}
+}
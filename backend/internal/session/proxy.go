@@ -0,0 +1,97 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// TrustedProxies are the reverse proxies, such as the frontend server or a
+// load balancer, whose X-Forwarded-For header is believed.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies reads proxies given as addresses or CIDR ranges.
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(list))
+	for _, item := range list {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %q is not an address or CIDR range", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an address or CIDR range", item)
+		}
+		proxies = append(proxies, n)
+	}
+	return proxies, nil
+}
+
+// Trusts reports whether ip belongs to one of the proxies.
+func (t TrustedProxies) Trusts(ip net.IP) bool {
+	for _, n := range t {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP works out who sent r. Starting from the peer, each trusted proxy
+// is replaced by the address it says it forwarded for, right to left through
+// X-Forwarded-For, so a client cannot pick its address by sending the header
+// itself.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	addr := peerIP(r)
+	if len(t) == 0 {
+		return addr
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(addr)
+		if ip == nil || !t.Trusts(ip) {
+			break
+		}
+		if net.ParseIP(hops[i]) == nil {
+			// Garbage from an untrusted hop; the proxy is as far as we
+			// can tell
+			break
+		}
+		addr = hops[i]
+	}
+	return addr
+}
+
+// Middleware resolves the client address once per request, for ClientIP.
+func (t TrustedProxies) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, t.ClientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
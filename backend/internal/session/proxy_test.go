@@ -0,0 +1,53 @@
+package session
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies: %v", err)
+	}
+
+	cases := map[string]struct {
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		"direct":                 {"203.0.113.7:4000", nil, "203.0.113.7"},
+		"untrusted peer":         {"203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		"one proxy":              {"10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		"spoofed behind proxy":   {"10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		"two proxies":            {"192.168.1.5:4000", []string{"198.51.100.1, 10.1.2.3"}, "198.51.100.1"},
+		"split headers":          {"192.168.1.5:4000", []string{"198.51.100.1", "10.1.2.3"}, "198.51.100.1"},
+		"only proxies":           {"10.1.2.3:4000", []string{"10.9.9.9"}, "10.9.9.9"},
+		"garbage from proxy hop": {"10.1.2.3:4000", []string{"unknown"}, "10.1.2.3"},
+	}
+	for name, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.peer
+		for _, v := range c.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := proxies.ClientIP(r); got != c.want {
+			t.Errorf("%s: expected %s; got %s", name, c.want, got)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.1.2.3:4000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := TrustedProxies(nil).ClientIP(r); got != "10.1.2.3" {
+		t.Errorf("no proxies: expected the peer; got %s", got)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, bad := range []string{"localhost", "10.0.0.0/33", ""} {
+		if _, err := ParseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidSession  = errors.New("invalid session")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// lastSeenResolution is how stale LastSeenAt may get before a request
+// refreshes it, so every request does not turn into a write.
+const lastSeenResolution = time.Minute
+
+type SessionService struct {
+	collection *mongo.Collection
+	secret     []byte
+	ttl        time.Duration
+	freshTTL   time.Duration
+	watchers   *watchers
+}
+
+func NewSessionService(db *mongo.Database, secret []byte, ttl, freshTTL time.Duration) *SessionService {
+	return &SessionService{
+		collection: db.Collection("user_sessions"),
+		secret:     secret,
+		ttl:        ttl,
+		freshTTL:   freshTTL,
+		watchers:   newWatchers(),
+	}
+}
+
+// EnsureIndexes lets MongoDB drop sessions once they have expired.
+func (s *SessionService) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+	return err
+}
+
+// CreateSession stores a new session for the user and returns it together
+// with the signed token the client has to present on later requests. The
+// client's address and user agent are kept so the user can recognise the
+// session later. Having just signed in, the session starts out fresh.
+func (s *SessionService) CreateSession(ctx context.Context, userID primitive.ObjectID, ip, userAgent string) (*Session, string, error) {
+	return s.create(ctx, userID, "", s.ttl, ip, userAgent)
+}
+
+// CreateRecoverySession opens a session that only allows enrolling a new
+// passkey, for users who redeemed a recovery code.
+func (s *SessionService) CreateRecoverySession(ctx context.Context, userID primitive.ObjectID, ttl time.Duration, ip, userAgent string) (*Session, string, error) {
+	return s.create(ctx, userID, ScopeRecovery, ttl, ip, userAgent)
+}
+
+func (s *SessionService) create(ctx context.Context, userID primitive.ObjectID, scope string, ttl time.Duration, ip, userAgent string) (*Session, string, error) {
+	now := time.Now()
+	session := &Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		Scope:      scope,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if scope == "" {
+		session.FreshUntil = now.Add(s.freshTTL)
+	}
+
+	if _, err := s.collection.InsertOne(ctx, session); err != nil {
+		return nil, "", err
+	}
+
+	return session, s.sign(session.ID), nil
+}
+
+// GetSessionByToken verifies the token signature and returns the session it
+// refers to, provided it still exists and has not expired.
+func (s *SessionService) GetSessionByToken(ctx context.Context, token string) (*Session, error) {
+	id, err := s.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	err = s.collection.FindOne(ctx, bson.M{
+		"_id":        id,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidSession
+		}
+		return nil, err
+	}
+
+	if now := time.Now(); now.Sub(session.LastSeenAt) > lastSeenResolution {
+		session.LastSeenAt = now
+		_, err = s.collection.UpdateOne(ctx,
+			bson.M{"_id": session.ID},
+			bson.M{"$set": bson.M{"last_seen_at": now}},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &session, nil
+}
+
+// MarkFresh records that the session's user just proved their presence
+// again, and returns until when that counts.
+func (s *SessionService) MarkFresh(ctx context.Context, id primitive.ObjectID) (time.Time, error) {
+	until := time.Now().Add(s.freshTTL)
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": bson.M{"fresh_until": until}},
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if result.MatchedCount == 0 {
+		return time.Time{}, ErrSessionNotFound
+	}
+	return until, nil
+}
+
+// ListSessions returns the user's unexpired sessions, most recently used
+// first.
+func (s *SessionService) ListSessions(ctx context.Context, userID primitive.ObjectID) ([]Session, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"user_id":    userID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteSession ends a session. Requests presenting it are refused from now
+// on and anything watching it is told.
+func (s *SessionService) DeleteSession(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return err
+	}
+	s.watchers.revoke(id)
+	return nil
+}
+
+// RevokeSession ends one of the user's sessions.
+func (s *SessionService) RevokeSession(ctx context.Context, userID, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrSessionNotFound
+	}
+	s.watchers.revoke(id)
+	return nil
+}
+
+// RevokeAllSessions ends every session of the user except the ones listed
+// in keep, and returns how many were ended.
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID primitive.ObjectID, keep ...primitive.ObjectID) (int64, error) {
+	filter := bson.M{"user_id": userID}
+	if len(keep) > 0 {
+		filter["_id"] = bson.M{"$nin": keep}
+	}
+
+	// Find the IDs first so their watchers can be told
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var revoked []Session
+	if err := cursor.All(ctx, &revoked); err != nil {
+		return 0, err
+	}
+
+	result, err := s.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, sess := range revoked {
+		s.watchers.revoke(sess.ID)
+	}
+	return result.DeletedCount, nil
+}
+
+// Tokens have the form "<session id>.<signature>" where the signature is an
+// HMAC-SHA256 of the session id, so forged ids are rejected without a lookup.
+func (s *SessionService) sign(id primitive.ObjectID) string {
+	return id.Hex() + "." + base64.RawURLEncoding.EncodeToString(s.mac(id.Hex()))
+}
+
+func (s *SessionService) verify(token string) (primitive.ObjectID, error) {
+	idHex, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return primitive.NilObjectID, ErrInvalidSession
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(idHex)) {
+		return primitive.NilObjectID, ErrInvalidSession
+	}
+
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidSession
+	}
+	return id, nil
+}
+
+func (s *SessionService) mac(value string) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(value))
+	return m.Sum(nil)
+}
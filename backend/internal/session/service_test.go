@@ -0,0 +1,63 @@
+package session
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	s := &SessionService{secret: []byte("test-secret")}
+	id := primitive.NewObjectID()
+
+	got, err := s.verify(s.sign(id))
+	if err != nil {
+		t.Fatalf("verify returned error: %v", err)
+	}
+	if got != id {
+		t.Errorf("expected session ID %s; got %s", id.Hex(), got.Hex())
+	}
+}
+
+func TestTokenRejectsTampering(t *testing.T) {
+	s := &SessionService{secret: []byte("test-secret")}
+	other := &SessionService{secret: []byte("other-secret")}
+	token := s.sign(primitive.NewObjectID())
+
+	cases := map[string]string{
+		"wrong secret": other.sign(primitive.NewObjectID()),
+		"swapped id":   primitive.NewObjectID().Hex() + token[24:],
+		"missing dot":  token[:24],
+		"garbage":      "not-a-token",
+	}
+	for name, tok := range cases {
+		if _, err := s.verify(tok); err != ErrInvalidSession {
+			t.Errorf("%s: expected ErrInvalidSession; got %v", name, err)
+		}
+	}
+}
+
+func TestWatchersRevoke(t *testing.T) {
+	w := newWatchers()
+	id := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+
+	revoked := w.add(id)
+	untouched := w.add(other)
+	w.revoke(id)
+
+	select {
+	case <-revoked:
+	default:
+		t.Error("expected watcher of revoked session to be closed")
+	}
+	select {
+	case <-untouched:
+		t.Error("expected watcher of other session to stay open")
+	default:
+	}
+
+	// Removing after a revoke must not panic or close twice
+	w.remove(id, revoked)
+	w.revoke(id)
+}
@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// watchers tracks long-lived connections that have to end when their
+// session does, such as poll update streams.
+type watchers struct {
+	mutex sync.Mutex
+	byID  map[primitive.ObjectID]map[chan struct{}]struct{}
+}
+
+func newWatchers() *watchers {
+	return &watchers{byID: make(map[primitive.ObjectID]map[chan struct{}]struct{})}
+}
+
+func (w *watchers) add(id primitive.ObjectID) chan struct{} {
+	ch := make(chan struct{})
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, ok := w.byID[id]; !ok {
+		w.byID[id] = make(map[chan struct{}]struct{})
+	}
+	w.byID[id][ch] = struct{}{}
+	return ch
+}
+
+func (w *watchers) remove(id primitive.ObjectID, ch chan struct{}) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, ok := w.byID[id][ch]; !ok {
+		return
+	}
+	delete(w.byID[id], ch)
+	if len(w.byID[id]) == 0 {
+		delete(w.byID, id)
+	}
+}
+
+// revoke closes every channel watching id.
+func (w *watchers) revoke(id primitive.ObjectID) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for ch := range w.byID[id] {
+		close(ch)
+	}
+	delete(w.byID, id)
+}
+
+func (w *watchers) ids() []primitive.ObjectID {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	ids := make([]primitive.ObjectID, 0, len(w.byID))
+	for id := range w.byID {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Watch returns a channel that is closed once the session is revoked or
+// expires, and a function to call when the caller stops watching.
+func (s *SessionService) Watch(id primitive.ObjectID) (<-chan struct{}, func()) {
+	ch := s.watchers.add(id)
+	return ch, func() { s.watchers.remove(id, ch) }
+}
+
+// SweepWatched checks every interval that the watched sessions still exist,
+// so sessions revoked by another instance or expired in place are noticed
+// too. It runs until ctx is cancelled.
+func (s *SessionService) SweepWatched(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sweepWatched(ctx); err != nil {
+				log.Printf("Error checking watched sessions: %v", err)
+			}
+		}
+	}
+}
+
+func (s *SessionService) sweepWatched(ctx context.Context) error {
+	ids := s.watchers.ids()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{
+		"_id":        bson.M{"$in": ids},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	var live []Session
+	if err := cursor.All(ctx, &live); err != nil {
+		return err
+	}
+
+	alive := make(map[primitive.ObjectID]bool, len(live))
+	for _, sess := range live {
+		alive[sess.ID] = true
+	}
+	for _, id := range ids {
+		if !alive[id] {
+			s.watchers.revoke(id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package throttle
+
+import "time"
+
+// Attempts tracks recent authentication failures for one key, such as an
+// account or a client IP.
+type Attempts struct {
+	Key           string    `bson:"_id"`
+	Failures      int       `bson:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at"`
+	LockedUntil   time.Time `bson:"locked_until,omitempty"`
+	// ExpiresAt lets MongoDB forget keys that have been quiet for a
+	// policy window.
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Policy describes how quickly a key is slowed down. The first Threshold
+// failures are free; each one after that doubles the lockout, starting at
+// BaseDelay and capped at MaxDelay. Failures are forgotten after Window
+// without a new one.
+type Policy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Window    time.Duration
+}
+
+// lockout returns how long a key with the given number of failures is
+// locked out.
+func (p Policy) lockout(failures int) time.Duration {
+	over := failures - p.Threshold
+	if over <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < over && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
@@ -0,0 +1,26 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyLockout(t *testing.T) {
+	p := Policy{Threshold: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	cases := map[int]time.Duration{
+		0:  0,
+		3:  0,
+		4:  time.Second,
+		5:  2 * time.Second,
+		6:  4 * time.Second,
+		7:  8 * time.Second,
+		8:  10 * time.Second,
+		50: 10 * time.Second,
+	}
+	for failures, want := range cases {
+		if got := p.lockout(failures); got != want {
+			t.Errorf("%d failures: expected %v; got %v", failures, want, got)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package throttle
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// AccountPolicy protects a single account from guessing, wherever the
+	// attempts come from.
+	AccountPolicy = Policy{Threshold: 5, BaseDelay: 2 * time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+	// IPPolicy slows down one client probing many accounts.
+	IPPolicy = Policy{Threshold: 20, BaseDelay: 2 * time.Second, MaxDelay: time.Hour, Window: time.Hour}
+)
+
+// Key identifies what attempts are counted against.
+type Key struct {
+	ID     string
+	Policy Policy
+}
+
+// AccountKey counts attempts against an account, by the email it was
+// addressed with, whether or not the account exists.
+func AccountKey(email string) Key {
+	return Key{ID: "account:" + strings.ToLower(strings.TrimSpace(email)), Policy: AccountPolicy}
+}
+
+func IPKey(ip string) Key {
+	return Key{ID: "ip:" + ip, Policy: IPPolicy}
+}
+
+// Limiter records failed authentication attempts in MongoDB, so lockouts
+// survive restarts and apply across instances.
+type Limiter struct {
+	collection *mongo.Collection
+}
+
+func NewLimiter(db *mongo.Database) *Limiter {
+	return &Limiter{
+		collection: db.Collection("login_attempts"),
+	}
+}
+
+func (l *Limiter) EnsureIndexes(ctx context.Context) error {
+	_, err := l.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Check returns how long the caller has to wait before trying again, or zero
+// if none of the keys is locked.
+func (l *Limiter) Check(ctx context.Context, keys ...Key) (time.Duration, error) {
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = key.ID
+	}
+
+	cursor, err := l.collection.Find(ctx, bson.M{
+		"_id":          bson.M{"$in": ids},
+		"locked_until": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var locked []Attempts
+	if err := cursor.All(ctx, &locked); err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, a := range locked {
+		wait = max(wait, time.Until(a.LockedUntil))
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed attempt against every key and extends their
+// lockouts according to each key's policy.
+func (l *Limiter) RecordFailure(ctx context.Context, keys ...Key) error {
+	now := time.Now()
+	for _, key := range keys {
+		var a Attempts
+		err := l.collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": key.ID},
+			bson.M{
+				"$inc": bson.M{"failures": 1},
+				"$set": bson.M{
+					"last_failure_at": now,
+					"expires_at":      now.Add(key.Policy.Window),
+				},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&a)
+		if err != nil {
+			return err
+		}
+
+		if delay := key.Policy.lockout(a.Failures); delay > 0 {
+			_, err = l.collection.UpdateOne(ctx,
+				bson.M{"_id": key.ID},
+				bson.M{"$set": bson.M{"locked_until": now.Add(delay)}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Reset forgets the failures recorded against keys, after a successful
+// login.
+func (l *Limiter) Reset(ctx context.Context, keys ...Key) error {
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = key.ID
+	}
+	_, err := l.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
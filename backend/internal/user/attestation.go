@@ -0,0 +1,121 @@
+package user
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAuthenticatorNotAllowed = errors.New("This authenticator model is not allowed")
+	ErrAttestationRequired     = errors.New("This account requires a security key with verified attestation")
+)
+
+// AttestationRequirement is what a role asks of its members' passkeys on top
+// of the global allow and deny lists.
+type AttestationRequirement struct {
+	// RequireAttestation accepts only authenticators that sent an
+	// attestation statement and have an entry in the metadata blob, which
+	// go-webauthn then checks the statement against.
+	RequireAttestation bool
+	// AllowAAGUIDs, when not empty, limits the role to these models.
+	AllowAAGUIDs []uuid.UUID
+}
+
+// AttestationPolicy decides which authenticators may hold passkeys. The
+// AAGUID of an authenticator that sent no attestation is only its own claim,
+// so the lists keep honest clients in line; roles that must be sure about
+// the hardware also require attestation.
+//
+// A nil policy allows everything.
+type AttestationPolicy struct {
+	AllowAAGUIDs []uuid.UUID
+	DenyAAGUIDs  []uuid.UUID
+	Roles        map[Role]AttestationRequirement
+	// Metadata is the FIDO metadata blob, keyed by AAGUID.
+	Metadata map[uuid.UUID]*metadata.Entry
+}
+
+// Conveyance is the attestation preference to request when registering a
+// passkey for role, or "" to keep the configured default.
+func (p *AttestationPolicy) Conveyance(role Role) protocol.ConveyancePreference {
+	if p.Requires(role) {
+		return protocol.PreferDirectAttestation
+	}
+	return ""
+}
+
+// Requires reports whether role has requirements of its own.
+func (p *AttestationPolicy) Requires(role Role) bool {
+	if p == nil {
+		return false
+	}
+	req, ok := p.Roles[role]
+	return ok && (req.RequireAttestation || len(req.AllowAAGUIDs) > 0)
+}
+
+// CheckRegistration reports why a newly created credential may not be
+// registered to an account with role, if it may not.
+func (p *AttestationPolicy) CheckRegistration(role Role, c *webauthn.Credential) error {
+	if p == nil {
+		return nil
+	}
+	aaguid := credentialAAGUID(c)
+	if slices.Contains(p.DenyAAGUIDs, aaguid) {
+		return ErrAuthenticatorNotAllowed
+	}
+	if len(p.AllowAAGUIDs) > 0 && !slices.Contains(p.AllowAAGUIDs, aaguid) {
+		return ErrAuthenticatorNotAllowed
+	}
+	return p.CheckRole(role, c)
+}
+
+// CheckRole applies only the requirements of role. It is what existing
+// credentials are held to when signing in, so changing the global lists
+// never locks anyone out of an account they already have.
+func (p *AttestationPolicy) CheckRole(role Role, c *webauthn.Credential) error {
+	if p == nil {
+		return nil
+	}
+	req, ok := p.Roles[role]
+	if !ok {
+		return nil
+	}
+	aaguid := credentialAAGUID(c)
+	if len(req.AllowAAGUIDs) > 0 && !slices.Contains(req.AllowAAGUIDs, aaguid) {
+		return ErrAuthenticatorNotAllowed
+	}
+	if req.RequireAttestation {
+		format := protocol.AttestationFormat(c.AttestationType)
+		if format == "" || format == protocol.AttestationFormatNone || p.Metadata[aaguid] == nil {
+			return ErrAttestationRequired
+		}
+	}
+	return nil
+}
+
+// Satisfied reports whether u has at least one passkey that role accepts,
+// so giving u that role will not lock them out.
+func (p *AttestationPolicy) Satisfied(u *User, role Role) bool {
+	if !p.Requires(role) {
+		return true
+	}
+	for i := range u.Credentials {
+		if p.CheckRole(role, &u.Credentials[i].Credential) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func credentialAAGUID(c *webauthn.Credential) uuid.UUID {
+	aaguid, err := uuid.FromBytes(c.Authenticator.AAGUID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return aaguid
+}
@@ -0,0 +1,66 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+func TestAttestationPolicy(t *testing.T) {
+	yubikey := uuid.MustParse("cb69481e-8ff7-4039-93ec-0a2729a154a8")
+	synced := uuid.MustParse("ea9b8d66-4d01-1d21-3ce4-b6b48cb575d4")
+	banned := uuid.MustParse("00000000-0000-0000-0000-0000000000ff")
+
+	policy := &AttestationPolicy{
+		DenyAAGUIDs: []uuid.UUID{banned},
+		Roles: map[Role]AttestationRequirement{
+			RoleAdmin: {RequireAttestation: true, AllowAAGUIDs: []uuid.UUID{yubikey}},
+		},
+		Metadata: map[uuid.UUID]*metadata.Entry{yubikey: {AaGUID: yubikey}},
+	}
+	credential := func(aaguid uuid.UUID, format string) *webauthn.Credential {
+		return &webauthn.Credential{
+			AttestationType: format,
+			Authenticator:   webauthn.Authenticator{AAGUID: aaguid[:]},
+		}
+	}
+
+	cases := []struct {
+		name string
+		role Role
+		cred *webauthn.Credential
+		want error
+	}{
+		{"user with synced passkey", RoleUser, credential(synced, "none"), nil},
+		{"user with denied model", RoleUser, credential(banned, "none"), ErrAuthenticatorNotAllowed},
+		{"admin with attested key", RoleAdmin, credential(yubikey, "packed"), nil},
+		{"admin without attestation", RoleAdmin, credential(yubikey, "none"), ErrAttestationRequired},
+		{"admin with other model", RoleAdmin, credential(synced, "packed"), ErrAuthenticatorNotAllowed},
+	}
+	for _, c := range cases {
+		if got := policy.CheckRegistration(c.role, c.cred); got != c.want {
+			t.Errorf("%s: expected %v; got %v", c.name, c.want, got)
+		}
+	}
+
+	// Existing passkeys are only held to the role's requirements
+	if err := policy.CheckRole(RoleUser, credential(banned, "none")); err != nil {
+		t.Errorf("expected no role check for users; got %v", err)
+	}
+
+	u := &User{Credentials: []Credential{{Credential: *credential(synced, "none")}}}
+	if policy.Satisfied(u, RoleAdmin) {
+		t.Error("expected a user with only a synced passkey not to satisfy the admin policy")
+	}
+	u.Credentials = append(u.Credentials, Credential{Credential: *credential(yubikey, "packed")})
+	if !policy.Satisfied(u, RoleAdmin) {
+		t.Error("expected a user with an attested key to satisfy the admin policy")
+	}
+
+	var none *AttestationPolicy
+	if err := none.CheckRegistration(RoleAdmin, credential(banned, "none")); err != nil {
+		t.Errorf("expected a nil policy to allow everything; got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrCeremonyNotFound = errors.New("ceremony not found or expired")
+
+type CeremonyKind string
+
+const (
+	CeremonyRegistration CeremonyKind = "registration"
+	CeremonyLogin        CeremonyKind = "login"
+	// CeremonyDiscoverableLogin has no user until the assertion names one.
+	CeremonyDiscoverableLogin CeremonyKind = "discoverable_login"
+	// CeremonyReauthentication proves a signed-in user is still present.
+	CeremonyReauthentication CeremonyKind = "reauthentication"
+)
+
+// Ceremony is the server-side state of a WebAuthn ceremony between its begin
+// and finish steps. It is keyed by the challenge, so several ceremonies for
+// the same user can be in flight at once.
+type Ceremony struct {
+	Challenge string               `bson:"_id"`
+	Kind      CeremonyKind         `bson:"kind"`
+	UserID    primitive.ObjectID   `bson:"user_id,omitempty"`
+	Data      webauthn.SessionData `bson:"data"`
+	ExpiresAt time.Time            `bson:"expires_at"`
+}
+
+// CeremonyStore keeps ceremony state until it is consumed or expires.
+// Consume is one-shot: a challenge can be redeemed at most once.
+type CeremonyStore interface {
+	Save(ctx context.Context, c *Ceremony) error
+	Consume(ctx context.Context, challenge string, kind CeremonyKind) (*Ceremony, error)
+}
+
+func newCeremony(kind CeremonyKind, userID primitive.ObjectID, data *webauthn.SessionData) *Ceremony {
+	return &Ceremony{
+		Challenge: data.Challenge,
+		Kind:      kind,
+		UserID:    userID,
+		Data:      *data,
+	}
+}
+
+type MongoCeremonyStore struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+}
+
+func NewMongoCeremonyStore(db *mongo.Database, ttl time.Duration) *MongoCeremonyStore {
+	return &MongoCeremonyStore{
+		collection: db.Collection("ceremonies"),
+		ttl:        ttl,
+	}
+}
+
+// EnsureIndexes lets MongoDB reap abandoned ceremonies.
+func (s *MongoCeremonyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func (s *MongoCeremonyStore) Save(ctx context.Context, c *Ceremony) error {
+	c.ExpiresAt = time.Now().Add(s.ttl)
+	_, err := s.collection.InsertOne(ctx, c)
+	return err
+}
+
+func (s *MongoCeremonyStore) Consume(ctx context.Context, challenge string, kind CeremonyKind) (*Ceremony, error) {
+	// The TTL monitor only runs once a minute, so expiry is checked here too.
+	var c Ceremony
+	err := s.collection.FindOneAndDelete(ctx, bson.M{
+		"_id":        challenge,
+		"kind":       kind,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&c)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCeremonyNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// MemoryCeremonyStore is a CeremonyStore for single-instance deployments and
+// tests. Expired entries are swept whenever a new ceremony is saved.
+type MemoryCeremonyStore struct {
+	ttl        time.Duration
+	mutex      sync.Mutex
+	ceremonies map[string]*Ceremony
+}
+
+func NewMemoryCeremonyStore(ttl time.Duration) *MemoryCeremonyStore {
+	return &MemoryCeremonyStore{
+		ttl:        ttl,
+		ceremonies: make(map[string]*Ceremony),
+	}
+}
+
+func (s *MemoryCeremonyStore) Save(ctx context.Context, c *Ceremony) error {
+	now := time.Now()
+	c.ExpiresAt = now.Add(s.ttl)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for challenge, existing := range s.ceremonies {
+		if !existing.ExpiresAt.After(now) {
+			delete(s.ceremonies, challenge)
+		}
+	}
+	s.ceremonies[c.Challenge] = c
+	return nil
+}
+
+func (s *MemoryCeremonyStore) Consume(ctx context.Context, challenge string, kind CeremonyKind) (*Ceremony, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.ceremonies[challenge]
+	if !ok || c.Kind != kind {
+		return nil, ErrCeremonyNotFound
+	}
+	delete(s.ceremonies, challenge)
+
+	if !c.ExpiresAt.After(time.Now()) {
+		return nil, ErrCeremonyNotFound
+	}
+	return c, nil
+}
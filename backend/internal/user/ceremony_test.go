@@ -0,0 +1,43 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryCeremonyStoreConsumesOnce(t *testing.T) {
+	store := NewMemoryCeremonyStore(time.Minute)
+	ctx := context.Background()
+	c := newCeremony(CeremonyLogin, primitive.NewObjectID(), &webauthn.SessionData{Challenge: "abc"})
+
+	if err := store.Save(ctx, c); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if _, err := store.Consume(ctx, "abc", CeremonyRegistration); err != ErrCeremonyNotFound {
+		t.Errorf("expected kind mismatch to be rejected; got %v", err)
+	}
+	got, err := store.Consume(ctx, "abc", CeremonyLogin)
+	if err != nil {
+		t.Fatalf("Consume returned error: %v", err)
+	}
+	if got.UserID != c.UserID {
+		t.Errorf("expected user %s; got %s", c.UserID.Hex(), got.UserID.Hex())
+	}
+	if _, err := store.Consume(ctx, "abc", CeremonyLogin); err != ErrCeremonyNotFound {
+		t.Errorf("expected replayed challenge to be rejected; got %v", err)
+	}
+}
+
+func TestMemoryCeremonyStoreExpires(t *testing.T) {
+	store := NewMemoryCeremonyStore(-time.Second)
+	ctx := context.Background()
+
+	store.Save(ctx, newCeremony(CeremonyLogin, primitive.NilObjectID, &webauthn.SessionData{Challenge: "abc"}))
+	if _, err := store.Consume(ctx, "abc", CeremonyLogin); err != ErrCeremonyNotFound {
+		t.Errorf("expected expired ceremony to be rejected; got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package user
+
+import "context"
+
+type contextKey struct{}
+
+type accessTokenKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated user.
+func NewContext(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// FromContext returns the authenticated user stored in ctx, if any.
+func FromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(contextKey{}).(*User)
+	return u, ok && u != nil
+}
+
+// NewAccessTokenContext records that the request was authenticated with an
+// access token rather than a session.
+func NewAccessTokenContext(ctx context.Context, t *AccessToken) context.Context {
+	return context.WithValue(ctx, accessTokenKey{}, t)
+}
+
+// AccessTokenFromContext returns the access token the request was
+// authenticated with, if any.
+func AccessTokenFromContext(ctx context.Context) (*AccessToken, bool) {
+	t, ok := ctx.Value(accessTokenKey{}).(*AccessToken)
+	return t, ok
+}
@@ -1,32 +1,105 @@
 package user
 
 import (
-	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/throttle"
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UserHandler struct {
-	userService *UserService
-	webauthn    *webauthn.WebAuthn
-	db          *mongo.Database
+	userService    *UserService
+	registrations  registrationStore
+	sessionService *session.SessionService
+	webauthn       *webauthn.WebAuthn
+	ceremonies     CeremonyStore
+	verifier       *EmailVerifier
+	limiter        *throttle.Limiter
+	auditLog       *audit.AuditService
+	clonePolicy    ClonePolicy
+	attestation    *AttestationPolicy
+	bootstrapAdmin string
+	decoyKey       []byte
+	secureCookies  bool
 }
 
-func NewUserHandler(userService *UserService, webauthn *webauthn.WebAuthn, db *mongo.Database) *UserHandler {
+// HandlerOptions carries the settings UserHandler takes from configuration.
+type HandlerOptions struct {
+	ClonePolicy    ClonePolicy
+	Attestation    *AttestationPolicy
+	BootstrapAdmin string
+	// DecoyKey keys the made-up login options handed out for unknown
+	// accounts.
+	DecoyKey []byte
+	// SecureCookies marks the session cookie Secure.
+	SecureCookies bool
+}
+
+const (
+	defaultAccessTokenDays = 30
+	maxAccessTokenDays     = 365
+)
+
+// recoverySessionTTL bounds how long a redeemed recovery code stays usable
+// for enrolling a passkey.
+const recoverySessionTTL = 15 * time.Minute
+
+// ClonePolicy decides what happens when an authenticator reports a sign
+// counter that did not increase, which suggests its key has been copied.
+type ClonePolicy string
+
+const (
+	// ClonePolicyReject refuses the login. The warning is stored on the
+	// credential, so it stays blocked until the user revokes it.
+	ClonePolicyReject ClonePolicy = "reject"
+	// ClonePolicyFlag lets the login through and only records the warning.
+	ClonePolicyFlag ClonePolicy = "flag"
+)
+
+func NewUserHandler(userService *UserService, sessionService *session.SessionService, webauthn *webauthn.WebAuthn, ceremonies CeremonyStore, verifier *EmailVerifier, limiter *throttle.Limiter, auditLog *audit.AuditService, opts HandlerOptions) *UserHandler {
 	return &UserHandler{
-		userService: userService,
-		webauthn:    webauthn,
-		db:          db,
+		userService:    userService,
+		registrations:  userService,
+		sessionService: sessionService,
+		webauthn:       webauthn,
+		ceremonies:     ceremonies,
+		verifier:       verifier,
+		limiter:        limiter,
+		auditLog:       auditLog,
+		clonePolicy:    opts.ClonePolicy,
+		attestation:    opts.Attestation,
+		bootstrapAdmin: opts.BootstrapAdmin,
+		decoyKey:       opts.DecoyKey,
+		secureCookies:  opts.SecureCookies,
 	}
 }
 
+// registrationStore is the part of UserService that registration uses.
+type registrationStore interface {
+	GetUser(id primitive.ObjectID) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	CreateUser(user *User) error
+	ResumePendingRegistration(user *User, name string) error
+	CompleteRegistration(userID primitive.ObjectID, credential Credential, codes []RecoveryCode) error
+}
+
+// BeginRegistration starts the ceremony for a new account's first passkey.
+// Existing accounts add passkeys through BeginAddCredential, which takes a
+// fresh login, so a signed-in caller gets no shortcut here.
 func (h *UserHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name  string `json:"name"`
@@ -37,7 +110,17 @@ func (h *UserHandler) BeginRegistration(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err := h.userService.GetUserByEmail(req.Email)
+	existing, err := h.registrations.GetUserByEmail(req.Email)
+	if err == nil && existing.Pending {
+		// The earlier attempt never finished its ceremony; pick it up
+		// again instead of locking the address out.
+		if err := h.registrations.ResumePendingRegistration(existing, req.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.beginAddCredential(w, r, existing)
+		return
+	}
 	if err == nil {
 		http.Error(w, "User already exists", http.StatusConflict)
 		return
@@ -49,28 +132,23 @@ func (h *UserHandler) BeginRegistration(w http.ResponseWriter, r *http.Request)
 		DisplayName:  req.Name,
 		Email:        req.Email,
 		CreatedPolls: []primitive.ObjectID{},
-		Credentials:  []webauthn.Credential{},
+		Credentials:  []Credential{},
+		Pending:      true,
+		CreatedAt:    time.Now(),
 	}
 
-	webAuthnUser := NewWebAuthnUser(user)
-
-	options, sessionData, err := h.webauthn.BeginRegistration(webAuthnUser)
+	options, err := h.beginCredentialCeremony(r.Context(), user)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Store session data in MongoDB
-	_, err = h.db.Collection("sessions").InsertOne(r.Context(), bson.M{
-		"userId": user.ID,
-		"data":   sessionData,
-	})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	err = h.registrations.CreateUser(user)
+	if err == ErrEmailTaken {
+		http.Error(w, "User already exists", http.StatusConflict)
 		return
 	}
-
-	if err := h.userService.CreateUser(user); err != nil {
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -87,9 +165,13 @@ func (h *UserHandler) BeginRegistration(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
+// FinishRegistration stores the first passkey of a pending account, hands
+// out its recovery codes and signs it in. It never adds to an account that
+// is already registered, as that would trade a stale session for a fresh one.
 func (h *UserHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserID string          `json:"userId"`
+		Name   string          `json:"name"`
 		Data   json.RawMessage `json:"data"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -103,50 +185,73 @@ func (h *UserHandler) FinishRegistration(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := h.userService.GetUser(userID)
+	user, err := h.registrations.GetUser(userID)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	if !user.Pending {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
 
 	webAuthnUser := NewWebAuthnUser(user)
 
-	// Retrieve session data from MongoDB
-	var sessionDataDoc struct {
-		Data webauthn.SessionData `bson:"data"`
-	}
-	err = h.db.Collection("sessions").FindOne(r.Context(), bson.M{"userId": userID}).Decode(&sessionDataDoc)
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Data)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Look up the ceremony by the challenge the authenticator signed
+	ceremony, err := h.ceremonies.Consume(r.Context(), parsed.Response.CollectedClientData.Challenge, CeremonyRegistration)
+	if err != nil || ceremony.UserID != userID {
 		http.Error(w, "Session not found", http.StatusBadRequest)
 		return
 	}
-	
-	// Delete session data after retrieval
-	_, err = h.db.Collection("sessions").DeleteOne(r.Context(), bson.M{"userId": userID})
+
+	credential, err := h.webauthn.CreateCredential(webAuthnUser, ceremony.Data, parsed)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.checkAttestation(w, r, user, credential) {
 		return
 	}
 
-	newReq, err := createNewRequestWithBody(req.Data, r)
+	// New accounts get their recovery codes with the first passkey. This
+	// response is the only time the plain codes are ever shown.
+	recoveryCodes, hashed, err := generateRecoveryCodes()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	credential, err := h.webauthn.FinishRegistration(webAuthnUser, sessionDataDoc.Data, newReq)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	stored := newCredential(credential, req.Name)
+	err = h.registrations.CompleteRegistration(user.ID, stored, hashed)
+	if err == ErrRegistrationExpired {
+		http.Error(w, err.Error(), http.StatusGone)
 		return
 	}
-
-	user.Credentials = append(user.Credentials, *credential)
-	if err := h.userService.UpdateUser(user); err != nil {
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	user.Credentials = append(user.Credentials, stored)
+	user.RecoveryCodes = hashed
+	user.Pending = false
+
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionRegister, audit.OutcomeSuccess).
+		By(user.ID, user.Email).On(audit.TargetUser, user.ID.Hex()))
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionCredentialAdd, audit.OutcomeSuccess).
+		By(user.ID, user.Email).On(audit.TargetCredential, base64.RawURLEncoding.EncodeToString(credential.ID)))
 
-	w.WriteHeader(http.StatusOK)
+	// The account exists now, so ask the owner to prove the address. A mail
+	// failure should not undo the registration; the user can ask for
+	// another link.
+	if err := h.verifier.SendVerification(r.Context(), user.ID, user.Email); err != nil {
+		log.Printf("Error sending verification email: %v", err)
+	}
+	h.startSession(w, r, user, map[string]interface{}{"recovery_codes": recoveryCodes})
 }
 
 func (h *UserHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
@@ -157,10 +262,23 @@ func (h *UserHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	
+
+	if h.throttled(w, r, clientKey(r)) {
+		return
+	}
+
+	// Unknown and pending accounts get options for a made-up credential
+	// instead of a 404, so probing emails here learns nothing. No ceremony
+	// is stored for them, so finishing always fails.
 	user, err := h.userService.GetUserByEmail(req.Email)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if err != nil || user.Pending {
+		options, _, err := h.webauthn.BeginLogin(h.decoyUser(req.Email))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(options)
 		return
 	}
 
@@ -172,11 +290,7 @@ func (h *UserHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store session data in MongoDB
-	_, err = h.db.Collection("sessions").InsertOne(r.Context(), bson.M{
-		"userId": user.ID,
-		"data":   sessionData,
-	})
+	err = h.ceremonies.Save(r.Context(), newCeremony(CeremonyLogin, user.ID, sessionData))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -196,53 +310,167 @@ func (h *UserHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// userID, err := primitive.ObjectIDFromHex(req.UserID)
-	// if err != nil {
-	// 	http.Error(w, "Invalid user ID", http.StatusBadRequest)
-	// 	return
-	// }
+	keys := loginKeys(r, req.Email)
+	if h.throttled(w, r, clientKey(r)) {
+		return
+	}
 
-	user, err := h.userService.GetUserByEmail(req.Email)
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Data)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	webAuthnUser := NewWebAuthnUser(user)
+	// A missing account, a missing ceremony and a bad signature all look
+	// the same from outside.
+	user, err := h.userService.GetUserByEmail(req.Email)
+	if err != nil {
+		h.authFailed(w, r, req.Email, "unknown account", keys...)
+		return
+	}
 
-	// Retrieve session data from MongoDB
-	var sessionDataDoc struct {
-		Data webauthn.SessionData `bson:"data"`
+	// Look up the ceremony by the challenge the authenticator signed
+	ceremony, err := h.ceremonies.Consume(r.Context(), parsed.Response.CollectedClientData.Challenge, CeremonyLogin)
+	if err != nil || ceremony.UserID != user.ID {
+		h.authFailed(w, r, req.Email, "no ceremony", keys...)
+		return
 	}
-	err = h.db.Collection("sessions").FindOne(r.Context(), bson.M{"userId": user.ID}).Decode(&sessionDataDoc)
+
+	credential, err := h.webauthn.ValidateLogin(NewWebAuthnUser(user), ceremony.Data, parsed)
 	if err != nil {
-		http.Error(w, "Session not found", http.StatusBadRequest)
+		h.authFailed(w, r, req.Email, err.Error(), keys...)
 		return
 	}
-	
-	// Delete session data after retrieval
-	_, err = h.db.Collection("sessions").DeleteOne(r.Context(), bson.M{"userId": user.ID})
+
+	h.completeLogin(w, r, user, credential)
+}
+
+// BeginDiscoverableLogin starts a usernameless login. The options carry no
+// allowed credentials, so the browser offers every passkey it holds for us.
+func (h *UserHandler) BeginDiscoverableLogin(w http.ResponseWriter, r *http.Request) {
+	options, sessionData, err := h.webauthn.BeginDiscoverableLogin()
 	if err != nil {
-		log.Printf("Error deleting session: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	newReq, err := createNewRequestWithBody(req.Data, r)
+	err = h.ceremonies.Save(r.Context(), newCeremony(CeremonyDiscoverableLogin, primitive.NilObjectID, sessionData))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	_, err = h.webauthn.FinishLogin(webAuthnUser, sessionDataDoc.Data, newReq)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+func (h *UserHandler) FinishDiscoverableLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// There is no account to charge until the assertion checks out, so
+	// only the client IP is counted here.
+	ipKey := clientKey(r)
+	if h.throttled(w, r, ipKey) {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ceremony, err := h.ceremonies.Consume(r.Context(), parsed.Response.CollectedClientData.Challenge, CeremonyDiscoverableLogin)
+	if err != nil {
+		h.authFailed(w, r, "", "no ceremony", ipKey)
+		return
+	}
+
+	webAuthnUser, credential, err := h.webauthn.ValidatePasskeyLogin(h.findDiscoverableUser, ceremony.Data, parsed)
 	if err != nil {
-		log.Println(err.Error())
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		h.authFailed(w, r, "", err.Error(), ipKey)
+		return
+	}
+
+	h.completeLogin(w, r, webAuthnUser.(*WebAuthnUser).User, credential)
+}
+
+// completeLogin signs the user in unless the clone or attestation policy
+// forbids it, and then persists what the assertion told us about the
+// authenticator. A rejected assertion only leaves its clone warning behind.
+func (h *UserHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *User, credential *webauthn.Credential) {
+	if credential.Authenticator.CloneWarning {
+		event := audit.NewEvent(r, audit.ActionCloneWarning, audit.OutcomeSuccess).
+			By(user.ID, user.Email).
+			On(audit.TargetCredential, base64.RawURLEncoding.EncodeToString(credential.ID)).
+			With("policy", string(h.clonePolicy))
+		if h.clonePolicy == ClonePolicyReject {
+			if err := h.userService.FlagClonedCredential(user.ID, credential.ID); err != nil {
+				log.Printf("Error flagging cloned credential: %v", err)
+			}
+			h.auditLog.Record(r.Context(), event)
+			h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionLogin, audit.OutcomeFailure).
+				By(user.ID, user.Email).Because("clone warning"))
+			http.Error(w, "Authenticator may be cloned", http.StatusUnauthorized)
+			return
+		}
+		h.auditLog.Record(r.Context(), event)
+	}
+
+	// Credentials from before the user's role or its policy changed may
+	// no longer be good enough for it
+	if err := h.attestation.CheckRole(user.EffectiveRole(), credential); err != nil {
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionLogin, audit.OutcomeFailure).
+			By(user.ID, user.Email).
+			With("credential", base64.RawURLEncoding.EncodeToString(credential.ID)).
+			Because(err.Error()))
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := h.userService.RecordCredentialUse(user.ID, credential); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// Only the account's counter is cleared; clearing the IP would let
+	// anyone with an account of their own wipe it between guesses.
+	if err := h.limiter.Reset(r.Context(), throttle.AccountKey(user.Email)); err != nil {
+		log.Printf("Error resetting login attempts: %v", err)
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionLogin, audit.OutcomeSuccess).
+		By(user.ID, user.Email).
+		With("credential", base64.RawURLEncoding.EncodeToString(credential.ID)))
+
+	h.startSession(w, r, user, nil)
+}
+
+// findDiscoverableUser resolves the user handle from a discoverable
+// assertion, which is the WebAuthnID we registered: the user's ObjectID bytes.
+func (h *UserHandler) findDiscoverableUser(rawID, userHandle []byte) (webauthn.User, error) {
+	if len(userHandle) != len(primitive.ObjectID{}) {
+		return nil, fmt.Errorf("invalid user handle")
+	}
+
+	var userID primitive.ObjectID
+	copy(userID[:], userHandle)
+
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebAuthnUser(user), nil
 }
 
+// VerifyCredentials confirms the account behind the caller's session for
+// the frontend's sign-in. The caller must send the token returned by
+// /login/finish or /register/finish as a Bearer token, with the same email.
 func (h *UserHandler) VerifyCredentials(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email  string `json:"email"`
@@ -253,9 +481,18 @@ func (h *UserHandler) VerifyCredentials(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := h.userService.GetUserByEmail(req.Email)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	// The caller already holds a session, so only their own counter holds
+	// them back
+	keys := loginKeys(r, req.Email)
+	if h.throttled(w, r, clientKey(r)) {
+		return
+	}
+
+	// Only the signed-in owner of an account can have it confirmed, and
+	// everyone else gets the same answer whether or not it exists.
+	user, ok := FromContext(r.Context())
+	if !ok || !strings.EqualFold(user.Email, strings.TrimSpace(req.Email)) {
+		h.authFailed(w, r, req.Email, "not signed in", keys...)
 		return
 	}
 
@@ -263,16 +500,17 @@ func (h *UserHandler) VerifyCredentials(w http.ResponseWriter, r *http.Request)
 		"id":    user.ID.Hex(),
 		"email": user.Email,
 		"name":  user.Name,
+		"role":  user.EffectiveRole(),
 	}
 
 	if req.Action == "register" {
 		if len(user.Credentials) == 0 {
-			http.Error(w, "User not registered", http.StatusUnauthorized)
+			h.authFailed(w, r, req.Email, "no credentials", keys...)
 			return
 		}
 	} else if req.Action == "login" {
 		if len(user.Credentials) == 0 {
-			http.Error(w, "User not registered", http.StatusUnauthorized)
+			h.authFailed(w, r, req.Email, "no credentials", keys...)
 			return
 		}
 	} else {
@@ -284,14 +522,878 @@ func (h *UserHandler) VerifyCredentials(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
-func createNewRequestWithBody(data json.RawMessage, originalReq *http.Request) (*http.Request, error) {
-	bodyReader := bytes.NewReader(data)
-	newReq, err := http.NewRequest(originalReq.Method, originalReq.URL.String(), bodyReader)
+// beginCredentialCeremony starts a passkey registration for user and stores
+// the ceremony until the authenticator responds.
+func (h *UserHandler) beginCredentialCeremony(ctx context.Context, user *User) (*protocol.CredentialCreation, error) {
+	webAuthnUser := NewWebAuthnUser(user)
+
+	// Resident keys let the user sign in later from the passkey picker
+	// without typing their email first.
+	opts := []webauthn.RegistrationOption{
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webAuthnUser.CredentialDescriptors()),
+	}
+	if conveyance := h.attestation.Conveyance(h.registrationRole(user)); conveyance != "" {
+		opts = append(opts, webauthn.WithConveyancePreference(conveyance))
+	}
+	options, sessionData, err := h.webauthn.BeginRegistration(webAuthnUser, opts...)
 	if err != nil {
 		return nil, err
 	}
-	newReq.Header = originalReq.Header
-	newReq = newReq.WithContext(originalReq.Context())
-	return newReq, nil
+
+	if err := h.ceremonies.Save(ctx, newCeremony(CeremonyRegistration, user.ID, sessionData)); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// registrationRole is the role whose attestation policy new passkeys for
+// user must meet. The bootstrap admin is held to the admin policy from the
+// first passkey, so the promotion on verification cannot lock them out.
+func (h *UserHandler) registrationRole(user *User) Role {
+	if h.bootstrapAdmin != "" && strings.EqualFold(user.Email, h.bootstrapAdmin) {
+		return RoleAdmin
+	}
+	return user.EffectiveRole()
+}
+
+// checkAttestation applies the attestation policy to a credential that has
+// just been created for user and answers 403 if it is not accepted.
+func (h *UserHandler) checkAttestation(w http.ResponseWriter, r *http.Request, user *User, credential *webauthn.Credential) bool {
+	role := h.registrationRole(user)
+	err := h.attestation.CheckRegistration(role, credential)
+	if err == nil {
+		return true
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionCredentialAdd, audit.OutcomeFailure).
+		By(user.ID, user.Email).
+		On(audit.TargetCredential, base64.RawURLEncoding.EncodeToString(credential.ID)).
+		With("aaguid", credentialAAGUID(credential).String()).
+		With("format", credential.AttestationType).
+		With("role", string(role)).
+		Because(err.Error()))
+	http.Error(w, err.Error(), http.StatusForbidden)
+	return false
+}
+
+// BeginAddCredential starts registering another passkey for the signed-in user.
+func (h *UserHandler) BeginAddCredential(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.beginAddCredential(w, r, caller)
+}
+
+func (h *UserHandler) beginAddCredential(w http.ResponseWriter, r *http.Request, user *User) {
+	options, err := h.beginCredentialCeremony(r.Context(), user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		UserID  string                       `json:"userId"`
+		Options *protocol.CredentialCreation `json:"options"`
+	}{
+		UserID:  user.ID.Hex(),
+		Options: options,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *UserHandler) FinishAddCredential(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name string          `json:"name"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ceremony, err := h.ceremonies.Consume(r.Context(), parsed.Response.CollectedClientData.Challenge, CeremonyRegistration)
+	if err != nil || ceremony.UserID != caller.ID {
+		http.Error(w, "Session not found", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := h.webauthn.CreateCredential(NewWebAuthnUser(caller), ceremony.Data, parsed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.checkAttestation(w, r, caller, credential) {
+		return
+	}
+
+	added := newCredential(credential, req.Name)
+	if err := h.userService.AddCredential(caller.ID, added); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	event := audit.NewEvent(r, audit.ActionCredentialAdd, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetCredential, base64.RawURLEncoding.EncodeToString(credential.ID))
+
+	// A recovery session has done its one job; the user signs in with the
+	// new passkey from here on.
+	if sess, ok := session.FromContext(r.Context()); ok && sess.IsRecovery() {
+		if err := h.sessionService.DeleteSession(r.Context(), sess.ID); err != nil {
+			log.Printf("Error ending recovery session: %v", err)
+		}
+		event = event.With("via", "recovery")
+	}
+	h.auditLog.Record(r.Context(), event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(NewCredentialView(&added))
+}
+
+func (h *UserHandler) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	views := make([]CredentialView, len(caller.Credentials))
+	for i := range caller.Credentials {
+		views[i] = NewCredentialView(&caller.Credentials[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func (h *UserHandler) RenameCredential(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	credentialID, err := base64.RawURLEncoding.DecodeString(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	err = h.userService.RenameCredential(caller.ID, credentialID, req.Name)
+	if err == ErrCredentialNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionCredentialRename, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetCredential, mux.Vars(r)["id"]).
+		With("name", req.Name))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) RevokeCredential(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	credentialID, err := base64.RawURLEncoding.DecodeString(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid credential ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.userService.RemoveCredential(caller.ID, credentialID)
+	switch err {
+	case nil:
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionCredentialRevoke, audit.OutcomeSuccess).
+			By(caller.ID, caller.Email).On(audit.TargetCredential, mux.Vars(r)["id"]))
+		w.WriteHeader(http.StatusNoContent)
+	case ErrCredentialNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrLastCredential:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
+// VerifyEmail confirms an email address from the token in a verification
+// link: either the address the account signed up with, or a new one it is
+// moving to.
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.verifier.Verify(req.Token)
+	if err == nil {
+		if v.Purpose == PurposeChangeEmail {
+			err = h.userService.ConfirmEmailChange(r.Context(), v.UserID, v.Email)
+		} else {
+			err = h.userService.MarkEmailVerified(v.UserID, v.Email)
+		}
+	}
+	switch err {
+	case nil:
+	case ErrInvalidVerificationToken:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case ErrEmailTaken:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	userID, email := v.UserID, v.Email
+
+	action := audit.ActionEmailVerify
+	if v.Purpose == PurposeChangeEmail {
+		action = audit.ActionEmailChange
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, action, audit.OutcomeSuccess).
+		By(userID, email).On(audit.TargetUser, userID.Hex()))
+
+	// The configured bootstrap admin becomes admin once the address is proven
+	if h.bootstrapAdmin != "" && strings.EqualFold(email, h.bootstrapAdmin) {
+		promoted, err := h.userService.BootstrapAdmin(r.Context(), email)
+		if err != nil {
+			log.Printf("Error bootstrapping admin: %v", err)
+		} else if promoted {
+			h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionRoleChange, audit.OutcomeSuccess).
+				By(userID, email).
+				On(audit.TargetUser, userID.Hex()).
+				With("role", string(RoleAdmin)).
+				With("via", "bootstrap"))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification mails the signed-in user a new verification link.
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if caller.EmailVerified {
+		http.Error(w, "Email already verified", http.StatusConflict)
+		return
+	}
+
+	if err := h.verifier.SendVerification(r.Context(), caller.ID, caller.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RegenerateRecoveryCodes replaces the signed-in user's recovery codes and
+// returns the new ones. Earlier codes stop working immediately.
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	codes, records, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.userService.ReplaceRecoveryCodes(caller.ID, records); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionRecoveryRegenerate, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetUser, caller.ID.Hex()))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+// RedeemRecoveryCode trades a recovery code for a short-lived session that
+// can only enroll a new passkey.
+func (h *UserHandler) RedeemRecoveryCode(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keys := loginKeys(r, req.Email)
+	if h.throttled(w, r, keys...) {
+		return
+	}
+
+	user, err := h.userService.GetUserByEmail(req.Email)
+	if err == nil {
+		err = h.userService.RedeemRecoveryCode(user.ID, req.Code, session.ClientIP(r), r.UserAgent())
+	}
+	if err != nil {
+		h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionRecoveryRedeem, audit.OutcomeFailure).
+			ByEmail(req.Email).Because(err.Error()))
+		if err := h.limiter.RecordFailure(r.Context(), keys...); err != nil {
+			log.Printf("Error recording failed login: %v", err)
+		}
+		http.Error(w, ErrInvalidRecoveryCode.Error(), http.StatusUnauthorized)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionRecoveryRedeem, audit.OutcomeSuccess).
+		By(user.ID, user.Email).On(audit.TargetUser, user.ID.Hex()))
+
+	sess, token, err := h.sessionService.CreateRecoverySession(r.Context(), user.ID, recoverySessionTTL, session.ClientIP(r), r.UserAgent())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session.SetCookie(w, token, sess.ExpiresAt, h.secureCookies)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"expires_at": sess.ExpiresAt,
+		"scope":      sess.Scope,
+	})
+}
+
+func (h *UserHandler) ListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokens := caller.AccessTokens
+	if tokens == nil {
+		tokens = []AccessToken{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// CreateAccessToken mints a token for the signed-in user. The plain token is
+// only part of this response.
+func (h *UserHandler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name          string  `json:"name"`
+		Scopes        []Scope `json:"scopes"`
+		ExpiresInDays int     `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !scope.Valid() {
+			http.Error(w, fmt.Sprintf("Invalid scope %q", scope), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAccessTokenDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxAccessTokenDays {
+		http.Error(w, fmt.Sprintf("expires_in_days must be between 1 and %d", maxAccessTokenDays), http.StatusBadRequest)
+		return
+	}
+
+	plain, token, err := newAccessToken(req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.userService.AddAccessToken(caller.ID, token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionTokenCreate, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetAccessToken, token.ID.Hex()).
+		With("name", token.Name))
+
+	response := struct {
+		AccessToken
+		Token string `json:"token"`
+	}{
+		AccessToken: token,
+		Token:       plain,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *UserHandler) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.userService.RevokeAccessToken(caller.ID, tokenID)
+	if err == ErrAccessTokenNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionTokenRevoke, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetAccessToken, tokenID.Hex()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxDisplayNameLength bounds display names, in characters.
+const maxDisplayNameLength = 64
+
+// Profile is what the signed-in user sees and edits about their account.
+type Profile struct {
+	ID            primitive.ObjectID `json:"id"`
+	Name          string             `json:"name"`
+	DisplayName   string             `json:"display_name"`
+	Email         string             `json:"email"`
+	EmailVerified bool               `json:"email_verified"`
+	PendingEmail  string             `json:"pending_email,omitempty"`
+	Role          Role               `json:"role"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+func NewProfile(u *User) Profile {
+	return Profile{
+		ID:            u.ID,
+		Name:          u.Name,
+		DisplayName:   u.DisplayName,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		PendingEmail:  u.PendingEmail,
+		Role:          u.EffectiveRole(),
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewProfile(caller))
+}
+
+func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	if req.DisplayName == "" {
+		http.Error(w, "Display name is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.DisplayName) > maxDisplayNameLength {
+		http.Error(w, fmt.Sprintf("Display name must be at most %d characters", maxDisplayNameLength), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.UpdateDisplayName(r.Context(), caller.ID, req.DisplayName); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionProfileUpdate, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetUser, caller.ID.Hex()).
+		With("display_name", req.DisplayName))
+
+	caller.DisplayName = req.DisplayName
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewProfile(caller))
+}
+
+// ChangeEmail starts moving the account to a new address. Nothing changes
+// until the link mailed to the new address is opened; the current address
+// keeps working meanwhile.
+func (h *UserHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || addr.Name != "" {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	newEmail := addr.Address
+	if strings.EqualFold(newEmail, caller.Email) {
+		http.Error(w, "That is already your email address", http.StatusBadRequest)
+		return
+	}
+
+	err = h.userService.RequestEmailChange(r.Context(), caller.ID, newEmail)
+	if err == ErrEmailTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.verifier.SendEmailChange(r.Context(), caller.ID, newEmail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionEmailChangeRequest, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetUser, caller.ID.Hex()).
+		With("pending_email", newEmail))
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ListSessions shows the signed-in user where else they are signed in.
+func (h *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var currentID primitive.ObjectID
+	if sess, ok := session.FromContext(r.Context()); ok {
+		currentID = sess.ID
+	}
+
+	sessions, err := h.sessionService.ListSessions(r.Context(), caller.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]session.View, len(sessions))
+	for i := range sessions {
+		views[i] = session.NewView(&sessions[i], currentID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+func (h *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.sessionService.RevokeSession(r.Context(), caller.ID, sessionID)
+	if err == session.ErrSessionNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionSessionRevoke, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetSession, sessionID.Hex()))
+
+	if sess, ok := session.FromContext(r.Context()); ok && sess.ID == sessionID {
+		session.ClearCookie(w, h.secureCookies)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeAllSessions signs the user out everywhere. With keep_current=true
+// the session making the request survives.
+func (h *UserHandler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	current, hasCurrent := session.FromContext(r.Context())
+	keepCurrent := hasCurrent && r.URL.Query().Get("keep_current") == "true"
+
+	var keep []primitive.ObjectID
+	if keepCurrent {
+		keep = append(keep, current.ID)
+	}
+
+	revoked, err := h.sessionService.RevokeAllSessions(r.Context(), caller.ID, keep...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionSessionRevoke, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetUser, caller.ID.Hex()).
+		With("revoked", fmt.Sprint(revoked)))
+
+	if !keepCurrent {
+		session.ClearCookie(w, h.secureCookies)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"revoked": revoked})
+}
+
+// Logout ends the session the request was made with. Recovery sessions can
+// be ended this way too.
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sess, ok := session.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.sessionService.DeleteSession(r.Context(), sess.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	event := audit.NewEvent(r, audit.ActionLogout, audit.OutcomeSuccess).By(sess.UserID, "")
+	if caller, ok := FromContext(r.Context()); ok {
+		event = event.By(caller.ID, caller.Email)
+	}
+	h.auditLog.Record(r.Context(), event.On(audit.TargetSession, sess.ID.Hex()))
+
+	session.ClearCookie(w, h.secureCookies)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginReauthentication starts a step-up check for the signed-in user: a
+// passkey assertion that refreshes their session before a sensitive action.
+func (h *UserHandler) BeginReauthentication(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	options, sessionData, err := h.webauthn.BeginLogin(NewWebAuthnUser(caller))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.ceremonies.Save(r.Context(), newCeremony(CeremonyReauthentication, caller.ID, sessionData))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// FinishReauthentication checks the step-up assertion and marks the session
+// fresh.
+func (h *UserHandler) FinishReauthentication(w http.ResponseWriter, r *http.Request) {
+	caller, ok := FromContext(r.Context())
+	sess, hasSession := session.FromContext(r.Context())
+	if !ok || !hasSession {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	failed := audit.NewEvent(r, audit.ActionReauthenticate, audit.OutcomeFailure).
+		By(caller.ID, caller.Email).On(audit.TargetSession, sess.ID.Hex())
+
+	ceremony, err := h.ceremonies.Consume(r.Context(), parsed.Response.CollectedClientData.Challenge, CeremonyReauthentication)
+	if err != nil || ceremony.UserID != caller.ID {
+		h.auditLog.Record(r.Context(), failed.Because("no ceremony"))
+		http.Error(w, errAuthenticationFailed, http.StatusUnauthorized)
+		return
+	}
+
+	credential, err := h.webauthn.ValidateLogin(NewWebAuthnUser(caller), ceremony.Data, parsed)
+	if err != nil {
+		h.auditLog.Record(r.Context(), failed.Because(err.Error()))
+		http.Error(w, errAuthenticationFailed, http.StatusUnauthorized)
+		return
+	}
+
+	// A possibly cloned authenticator is no proof of presence
+	if credential.Authenticator.CloneWarning && h.clonePolicy == ClonePolicyReject {
+		if err := h.userService.FlagClonedCredential(caller.ID, credential.ID); err != nil {
+			log.Printf("Error flagging cloned credential: %v", err)
+		}
+		h.auditLog.Record(r.Context(), failed.Because("clone warning"))
+		http.Error(w, "Authenticator may be cloned", http.StatusUnauthorized)
+		return
+	}
+	if err := h.attestation.CheckRole(caller.EffectiveRole(), credential); err != nil {
+		h.auditLog.Record(r.Context(), failed.Because(err.Error()))
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := h.userService.RecordCredentialUse(caller.ID, credential); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	freshUntil, err := h.sessionService.MarkFresh(r.Context(), sess.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionReauthenticate, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetSession, sess.ID.Hex()).
+		With("credential", base64.RawURLEncoding.EncodeToString(credential.ID)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"fresh_until": freshUntil})
+}
+
+// startSession issues a session for a user who just completed a passkey
+// ceremony. The token is set as a cookie and also returned in the body for
+// clients that prefer bearer auth, along with any extra response fields.
+func (h *UserHandler) startSession(w http.ResponseWriter, r *http.Request, user *User, extra map[string]interface{}) {
+	sess, token, err := h.sessionService.CreateSession(r.Context(), user.ID, session.ClientIP(r), r.UserAgent())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session.SetCookie(w, token, sess.ExpiresAt, h.secureCookies)
+
+	response := map[string]interface{}{
+		"token":      token,
+		"expires_at": sess.ExpiresAt,
+		"user": map[string]interface{}{
+			"id":             user.ID.Hex(),
+			"email":          user.Email,
+			"name":           user.Name,
+			"email_verified": user.EmailVerified,
+			"role":           user.EffectiveRole(),
+		},
+	}
+	for key, value := range extra {
+		response[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,85 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeRegistrations holds registered users and counts the writes made to
+// them.
+type fakeRegistrations struct {
+	users  []*User
+	writes int
+}
+
+func (f *fakeRegistrations) GetUser(id primitive.ObjectID) (*User, error) {
+	for _, u := range f.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, ErrCredentialNotFound
+}
+
+func (f *fakeRegistrations) GetUserByEmail(email string) (*User, error) {
+	for _, u := range f.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return nil, ErrCredentialNotFound
+}
+
+func (f *fakeRegistrations) CreateUser(user *User) error {
+	f.writes++
+	return nil
+}
+
+func (f *fakeRegistrations) ResumePendingRegistration(user *User, name string) error {
+	f.writes++
+	return nil
+}
+
+func (f *fakeRegistrations) CompleteRegistration(userID primitive.ObjectID, credential Credential, codes []RecoveryCode) error {
+	f.writes++
+	return nil
+}
+
+func TestRegistrationRefusesStaleSession(t *testing.T) {
+	caller := &User{ID: primitive.NewObjectID(), Email: "ann@example.com", Credentials: []Credential{{}}}
+	stale := &session.Session{ID: primitive.NewObjectID(), UserID: caller.ID, FreshUntil: time.Now().Add(-time.Hour)}
+	store := &fakeRegistrations{users: []*User{caller}}
+	ceremonies := NewMemoryCeremonyStore(time.Minute)
+	h := &UserHandler{registrations: store, ceremonies: ceremonies}
+
+	cases := map[string]struct {
+		handler http.HandlerFunc
+		body    string
+	}{
+		"begin":  {h.BeginRegistration, `{"name":"Ann","email":"ann@example.com"}`},
+		"finish": {h.FinishRegistration, `{"userId":"` + caller.ID.Hex() + `","data":{}}`},
+	}
+	for name, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+		ctx := NewContext(r.Context(), caller)
+		ctx = session.NewContext(ctx, stale)
+		w := httptest.NewRecorder()
+
+		c.handler(w, r.WithContext(ctx))
+		if w.Code != http.StatusConflict {
+			t.Errorf("%s: expected %d; got %d", name, http.StatusConflict, w.Code)
+		}
+		if cookie := w.Header().Get("Set-Cookie"); cookie != "" {
+			t.Errorf("%s: expected no session; got %s", name, cookie)
+		}
+	}
+	if store.writes != 0 || len(ceremonies.ceremonies) != 0 {
+		t.Errorf("expected no ceremony and no writes; got %d ceremonies, %d writes", len(ceremonies.ceremonies), store.writes)
+	}
+}
@@ -0,0 +1,87 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/session"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/throttle"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errAuthenticationFailed is the one answer every failed login gets, so it
+// does not tell whether the account exists.
+const errAuthenticationFailed = "Authentication failed"
+
+// loginKeys are the attempt counters a failed login for email is charged
+// against.
+//
+// Only secrets that can be guessed, such as recovery codes, are refused
+// while the account counter is locked. A passkey cannot be guessed, so
+// passkey logins are only held back by the client's own counter; otherwise
+// anyone could lock an owner out of their account by failing logins for it.
+func loginKeys(r *http.Request, email string) []throttle.Key {
+	return []throttle.Key{throttle.AccountKey(email), clientKey(r)}
+}
+
+// clientKey is the attempt counter of whoever sent r.
+func clientKey(r *http.Request) throttle.Key {
+	return throttle.IPKey(session.ClientIP(r))
+}
+
+// throttled answers 429 and reports true if any of keys is locked out.
+func (h *UserHandler) throttled(w http.ResponseWriter, r *http.Request, keys ...throttle.Key) bool {
+	wait, err := h.limiter.Check(r.Context(), keys...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// authFailed records a failed login by whoever claimed email, charges it
+// against keys and answers with the uniform 401. The reason only goes to the
+// audit log.
+func (h *UserHandler) authFailed(w http.ResponseWriter, r *http.Request, email, reason string, keys ...throttle.Key) {
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionLogin, audit.OutcomeFailure).
+		ByEmail(email).Because(reason))
+	if err := h.limiter.RecordFailure(r.Context(), keys...); err != nil {
+		log.Printf("Error recording failed login: %v", err)
+	}
+	http.Error(w, errAuthenticationFailed, http.StatusUnauthorized)
+}
+
+// decoyUser stands in for an account that does not exist, so BeginLogin
+// answers with options shaped like a real user's. Its credential ID is
+// derived from the email, so asking twice gives the same answer, as it would
+// for a real account.
+func (h *UserHandler) decoyUser(email string) *WebAuthnUser {
+	mac := hmac.New(sha256.New, h.decoyKey)
+	mac.Write([]byte("decoy-login:" + strings.ToLower(strings.TrimSpace(email))))
+	sum := mac.Sum(nil)
+
+	var id primitive.ObjectID
+	copy(id[:], sum)
+
+	return NewWebAuthnUser(&User{
+		ID:    id,
+		Email: email,
+		Credentials: []Credential{{Credential: webauthn.Credential{
+			ID:        sum,
+			Transport: []protocol.AuthenticatorTransport{protocol.Internal, protocol.Hybrid},
+		}}},
+	})
+}
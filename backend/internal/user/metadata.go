@@ -0,0 +1,102 @@
+package user
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/metadata"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// LoadMetadata reads a FIDO Metadata Service blob that was downloaded ahead
+// of time from https://mds3.fidoalliance.org/. The blob's signature is
+// checked against the FIDO root certificate, but certificate revocation is
+// not, since that needs the network; refreshing the file is how revocations
+// and status changes reach us.
+func LoadMetadata(path string) (map[uuid.UUID]*metadata.Entry, time.Time, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	blob = bytes.TrimSpace(blob)
+
+	if _, err := jwt.Parse(string(blob), metadataSigningKey, jwt.WithoutClaimsValidation()); err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid metadata blob signature: %v", err)
+	}
+
+	// The claims are decoded again into the library's own types; jwt has
+	// already turned them into generic maps.
+	parts := strings.Split(string(blob), ".")
+	claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var payload metadata.PayloadJSON
+	if err := json.Unmarshal(claims, &payload); err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid metadata blob payload: %v", err)
+	}
+
+	decoder, err := metadata.NewDecoder(metadata.WithIgnoreEntryParsingErrors())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	parsed, err := decoder.Parse(&payload)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return parsed.ToMap(), parsed.Parsed.NextUpdate, nil
+}
+
+// metadataSigningKey verifies the x5c chain in the blob header up to the
+// FIDO root and returns the signing certificate's key.
+func metadataSigningKey(token *jwt.Token) (interface{}, error) {
+	x5c, ok := token.Header["x5c"].([]interface{})
+	if !ok || len(x5c) == 0 {
+		return nil, errors.New("missing x5c header")
+	}
+
+	chain := make([]*x509.Certificate, len(x5c))
+	for i, value := range x5c {
+		encoded, ok := value.(string)
+		if !ok {
+			return nil, errors.New("malformed x5c header")
+		}
+		cert, err := parseBase64Certificate(encoded)
+		if err != nil {
+			return nil, err
+		}
+		chain[i] = cert
+	}
+
+	root, err := parseBase64Certificate(metadata.ProductionMDSRoot)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := chain[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+		return nil, err
+	}
+	return chain[0].PublicKey, nil
+}
+
+func parseBase64Certificate(encoded string) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -2,6 +2,12 @@
 package user
 
 import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -11,8 +17,97 @@ type User struct {
 	Name           string               `bson:"name" json:"name"`
 	DisplayName    string               `bson:"display_name" json:"display_name"`
 	Email          string               `bson:"email" json:"email"`
+	EmailVerified  bool                 `bson:"email_verified" json:"email_verified"`
+	// PendingEmail is an address the user asked to move to. Email stays
+	// in use until the new one is confirmed.
+	PendingEmail   string               `bson:"pending_email,omitempty" json:"pending_email,omitempty"`
+	Role           Role                 `bson:"role,omitempty" json:"role"`
 	CreatedPolls   []primitive.ObjectID `bson:"created_polls" json:"created_polls"`
-	Credentials    []webauthn.Credential `bson:"credentials" json:"credentials"`
+	Credentials    []Credential         `bson:"credentials" json:"credentials"`
+	RecoveryCodes  []RecoveryCode       `bson:"recovery_codes,omitempty" json:"-"`
+	AccessTokens   []AccessToken        `bson:"access_tokens,omitempty" json:"-"`
+	// Pending is set from BeginRegistration until the first passkey is
+	// stored. Pending users cannot sign in and are reaped if abandoned.
+	Pending        bool                 `bson:"pending" json:"-"`
+	CreatedAt      time.Time            `bson:"created_at,omitempty" json:"created_at"`
+}
+
+// RecoveryCode is a one-time code that lets a user who lost every passkey
+// enroll a new one. Only the hash is stored; the plain codes are shown once.
+type RecoveryCode struct {
+	Hash          string    `bson:"hash"`
+	UsedAt        time.Time `bson:"used_at,omitempty"`
+	UsedIP        string    `bson:"used_ip,omitempty"`
+	UsedUserAgent string    `bson:"used_user_agent,omitempty"`
+}
+
+// Credential is a registered passkey plus the metadata the user sees when
+// managing their devices. The webauthn fields are inlined so documents
+// written before this metadata existed still decode.
+type Credential struct {
+	webauthn.Credential `bson:",inline"`
+	Name                string    `bson:"name" json:"name"`
+	CreatedAt           time.Time `bson:"created_at" json:"created_at"`
+	LastUsedAt          time.Time `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+func newCredential(credential *webauthn.Credential, name string) Credential {
+	if name == "" {
+		name = "Passkey"
+	}
+	return Credential{
+		Credential: *credential,
+		Name:       name,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// CredentialView is what the passkey management API exposes; key material
+// and attestation data stay on the server.
+type CredentialView struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	AAGUID         string     `json:"aaguid"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	BackupEligible bool       `json:"backup_eligible"`
+	BackupState    bool       `json:"backup_state"`
+	CloneWarning   bool       `json:"clone_warning"`
+}
+
+func NewCredentialView(c *Credential) CredentialView {
+	view := CredentialView{
+		ID:             base64.RawURLEncoding.EncodeToString(c.ID),
+		Name:           c.Name,
+		AAGUID:         formatAAGUID(c.Authenticator.AAGUID),
+		CreatedAt:      c.CreatedAt,
+		BackupEligible: c.Flags.BackupEligible,
+		BackupState:    c.Flags.BackupState,
+		CloneWarning:   c.Authenticator.CloneWarning,
+	}
+	if !c.LastUsedAt.IsZero() {
+		lastUsed := c.LastUsedAt
+		view.LastUsedAt = &lastUsed
+	}
+	return view
+}
+
+// formatAAGUID renders an authenticator model ID in the usual UUID form.
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", aaguid[0:4], aaguid[4:6], aaguid[6:8], aaguid[8:10], aaguid[10:16])
+}
+
+// FindCredential returns the user's passkey with the given credential ID.
+func (u *User) FindCredential(id []byte) *Credential {
+	for i := range u.Credentials {
+		if bytes.Equal(u.Credentials[i].ID, id) {
+			return &u.Credentials[i]
+		}
+	}
+	return nil
 }
 
 // WebAuthnUser is an adapter that implements the webauthn.User interface
@@ -37,7 +132,21 @@ func (u *WebAuthnUser) WebAuthnIcon() string {
 }
 
 func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
-	return u.Credentials
+	credentials := make([]webauthn.Credential, len(u.Credentials))
+	for i, c := range u.Credentials {
+		credentials[i] = c.Credential
+	}
+	return credentials
+}
+
+// CredentialDescriptors lists the user's passkeys so a new registration can
+// exclude authenticators that are already enrolled.
+func (u *WebAuthnUser) CredentialDescriptors() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, len(u.Credentials))
+	for i, c := range u.Credentials {
+		descriptors[i] = c.Descriptor()
+	}
+	return descriptors
 }
 
 // NewWebAuthnUser creates a new WebAuthnUser from a User
@@ -0,0 +1,45 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	recoveryCodeCount = 10
+	// Crockford's base32 alphabet leaves out letters that are easy to
+	// confuse with digits when a code is typed back in from paper.
+	recoveryAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// generateRecoveryCodes returns fresh codes in the form "XXXXX-XXXXX" and the
+// hashed records to store in their place.
+func generateRecoveryCodes() ([]string, []RecoveryCode, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		for j, b := range raw {
+			raw[j] = recoveryAlphabet[int(b)%len(recoveryAlphabet)]
+		}
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+		records[i] = RecoveryCode{Hash: hashRecoveryCode(codes[i])}
+	}
+	return codes, records, nil
+}
+
+// hashRecoveryCode normalises what the user typed before hashing it, so case
+// and separators do not matter. The codes carry 50 bits of randomness, which
+// makes a plain SHA-256 sufficient.
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+package user
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, records, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes returned error: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(records) != recoveryCodeCount {
+		t.Fatalf("expected %d codes; got %d codes and %d records", recoveryCodeCount, len(codes), len(records))
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if records[i].Hash == code || records[i].Hash != hashRecoveryCode(code) {
+			t.Errorf("record %d does not hold the hash of its code", i)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestHashRecoveryCodeNormalises(t *testing.T) {
+	want := hashRecoveryCode("ABCDE-12345")
+	for _, typed := range []string{"abcde-12345", "ABCDE12345", " abcde 12345 "} {
+		if got := hashRecoveryCode(strings.TrimSpace(typed)); got != want {
+			t.Errorf("%q hashed differently from the canonical code", typed)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package user
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+type Permission string
+
+const (
+	// PermModeratePolls allows reviewing and acting on any user's polls.
+	PermModeratePolls Permission = "polls:moderate"
+	// PermManageUsers allows viewing and editing other accounts.
+	PermManageUsers Permission = "users:manage"
+	// PermManageRoles allows granting and revoking roles.
+	PermManageRoles Permission = "roles:manage"
+	// PermViewAudit allows reading the audit log.
+	PermViewAudit Permission = "audit:read"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {PermModeratePolls},
+	RoleAdmin:     {PermModeratePolls, PermManageUsers, PermManageRoles, PermViewAudit},
+}
+
+// EffectiveRole returns the user's role, treating accounts created before
+// roles existed as regular users.
+func (u *User) EffectiveRole() Role {
+	if u.Role == "" {
+		return RoleUser
+	}
+	return u.Role
+}
+
+// Can reports whether the user's role grants p.
+func (u *User) Can(p Permission) bool {
+	for _, granted := range rolePermissions[u.EffectiveRole()] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package user
+
+import "testing"
+
+func TestCan(t *testing.T) {
+	cases := []struct {
+		role Role
+		perm Permission
+		want bool
+	}{
+		{"", PermModeratePolls, false},
+		{RoleUser, PermModeratePolls, false},
+		{RoleModerator, PermModeratePolls, true},
+		{RoleModerator, PermManageRoles, false},
+		{RoleAdmin, PermManageRoles, true},
+		{"superuser", PermManageUsers, false},
+	}
+	for _, c := range cases {
+		u := &User{Role: c.role}
+		if got := u.Can(c.perm); got != c.want {
+			t.Errorf("role %q, permission %q: expected %v; got %v", c.role, c.perm, c.want, got)
+		}
+	}
+}
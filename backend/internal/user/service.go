@@ -2,13 +2,32 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var (
+	ErrCredentialNotFound  = errors.New("credential not found")
+	ErrLastCredential      = errors.New("cannot remove the last passkey")
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+	ErrAccessTokenNotFound = errors.New("access token not found")
+	ErrEmailTaken          = errors.New("email address is already in use")
+	ErrRegistrationExpired = errors.New("registration expired; please start again")
+)
+
+// emailCollation compares email addresses case-insensitively, both in
+// lookups and in the unique index, so Ada@example.com and ada@example.com
+// are one account.
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
 type UserService struct {
 	collection *mongo.Collection
 }
@@ -19,6 +38,84 @@ func NewUserService(db *mongo.Database) *UserService {
 	}
 }
 
+// DuplicateEmailsError keeps the unique email index from being built while
+// accounts from before it share an address that differs only in case.
+type DuplicateEmailsError struct {
+	// Emails holds the addresses of each group of clashing accounts.
+	Emails [][]string
+}
+
+func (e *DuplicateEmailsError) Error() string {
+	groups := make([]string, len(e.Emails))
+	for i, emails := range e.Emails {
+		groups[i] = strings.Join(emails, ", ")
+	}
+	return fmt.Sprintf("%d email addresses are used by more than one account when case is ignored (%s); "+
+		"change or remove all but one account of each, then restart", len(e.Emails), strings.Join(groups, "; "))
+}
+
+// EnsureIndexes creates the indexes for the pending registration reaper and
+// for access token lookups, and the unique email index. It returns a
+// DuplicateEmailsError rather than building the unique index over
+// addresses that clash.
+func (s *UserService) EnsureIndexes(ctx context.Context) error {
+	if err := s.checkDuplicateEmails(ctx); err != nil {
+		return err
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().
+				SetName("pending_created_at").
+				SetPartialFilterExpression(bson.M{"pending": true}),
+		},
+		{
+			Keys: bson.D{{Key: "access_tokens.hash", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().
+				SetName("email_unique").
+				SetUnique(true).
+				SetCollation(emailCollation),
+		},
+	})
+	return err
+}
+
+// checkDuplicateEmails groups the accounts by email under emailCollation,
+// the way the unique index compares them.
+func (s *UserService) checkDuplicateEmails(ctx context.Context) error {
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$email",
+			"emails": bson.M{"$push": "$email"},
+			"count":  bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}, options.Aggregate().SetCollation(emailCollation))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Emails []string `bson:"emails"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	dup := &DuplicateEmailsError{}
+	for _, g := range groups {
+		dup.Emails = append(dup.Emails, g.Emails)
+	}
+	return dup
+}
+
 func (s *UserService) GetUser(id primitive.ObjectID) (*User, error) {
 	var user User
 	err := s.collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&user)
@@ -31,8 +128,46 @@ func (s *UserService) GetUser(id primitive.ObjectID) (*User, error) {
 	return &user, nil
 }
 
+// GetUsers returns the users with the given IDs, in no particular order.
+// IDs without a user are skipped.
+func (s *UserService) GetUsers(ctx context.Context, ids []primitive.ObjectID) ([]User, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListRegisteredUsers returns the ID, role and creation time of every
+// account that finished registering, oldest first.
+func (s *UserService) ListRegisteredUsers(ctx context.Context) ([]User, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"pending": bson.M{"$ne": true}},
+		options.Find().
+			SetProjection(bson.M{"_id": 1, "role": 1, "created_at": 1}).
+			SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (s *UserService) CreateUser(user *User) error {
 	_, err := s.collection.InsertOne(context.Background(), user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
 	return err
 }
 
@@ -47,7 +182,9 @@ func (s *UserService) UpdateUser(user *User) error {
 
 func (s *UserService) GetUserByEmail(email string) (*User, error) {
 	var user User
-	err := s.collection.FindOne(context.Background(), bson.M{"email": email}).Decode(&user)
+	err := s.collection.FindOne(context.Background(), bson.M{"email": email},
+		options.FindOne().SetCollation(emailCollation),
+	).Decode(&user)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, fmt.Errorf("user not found")
@@ -55,4 +192,435 @@ func (s *UserService) GetUserByEmail(email string) (*User, error) {
 		return nil, err
 	}
 	return &user, nil
-}
\ No newline at end of file
+}
+
+// AddCredential appends a newly registered passkey to the user.
+func (s *UserService) AddCredential(userID primitive.ObjectID, credential Credential) error {
+	_, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$push": bson.M{"credentials": credential}},
+	)
+	return err
+}
+
+// CompleteRegistration gives a pending registration its first passkey and
+// recovery codes and makes it a full account. It fails with
+// ErrRegistrationExpired if the registration is no longer pending, because
+// the reaper removed it or another request completed it first.
+func (s *UserService) CompleteRegistration(userID primitive.ObjectID, credential Credential, codes []RecoveryCode) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID, "pending": true},
+		bson.M{
+			"$push": bson.M{"credentials": credential},
+			"$set":  bson.M{"pending": false, "recovery_codes": codes},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrRegistrationExpired
+	}
+	return nil
+}
+
+// RecordCredentialUse stores the sign counter and backup state reported by a
+// successful assertion. A clone warning is kept on the credential, with the
+// time it was first seen, so admins can review it later.
+func (s *UserService) RecordCredentialUse(userID primitive.ObjectID, credential *webauthn.Credential) error {
+	now := time.Now()
+	set := bson.M{
+		"credentials.$.authenticator.signcount": credential.Authenticator.SignCount,
+		"credentials.$.flags.userverified":      credential.Flags.UserVerified,
+		"credentials.$.flags.backupeligible":    credential.Flags.BackupEligible,
+		"credentials.$.flags.backupstate":       credential.Flags.BackupState,
+		"credentials.$.last_used_at":            now,
+	}
+	if credential.Authenticator.CloneWarning {
+		set["credentials.$.authenticator.clonewarning"] = true
+	}
+
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID, "credentials.id": credential.ID},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// FlagClonedCredential keeps the clone warning of an assertion that was
+// rejected for it, without taking its sign counter or other state.
+func (s *UserService) FlagClonedCredential(userID primitive.ObjectID, credentialID []byte) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID, "credentials.id": credentialID},
+		bson.M{"$set": bson.M{"credentials.$.authenticator.clonewarning": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+func (s *UserService) RenameCredential(userID primitive.ObjectID, credentialID []byte, name string) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID, "credentials.id": credentialID},
+		bson.M{"$set": bson.M{"credentials.$.name": name}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// RemoveCredential revokes a passkey. The filter only matches users with at
+// least two credentials, so the last one can never be removed, even by
+// concurrent requests.
+func (s *UserService) RemoveCredential(userID primitive.ObjectID, credentialID []byte) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{
+			"_id":            userID,
+			"credentials.id": credentialID,
+			"credentials.1":  bson.M{"$exists": true},
+		},
+		bson.M{"$pull": bson.M{"credentials": bson.M{"id": credentialID}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		user, err := s.GetUser(userID)
+		if err != nil {
+			return err
+		}
+		if user.FindCredential(credentialID) == nil {
+			return ErrCredentialNotFound
+		}
+		return ErrLastCredential
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes discards the user's old recovery codes.
+func (s *UserService) ReplaceRecoveryCodes(userID primitive.ObjectID, codes []RecoveryCode) error {
+	_, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"recovery_codes": codes}},
+	)
+	return err
+}
+
+// RedeemRecoveryCode marks an unused code as used. The match and the update
+// happen in one operation, so a code cannot be redeemed twice.
+func (s *UserService) RedeemRecoveryCode(userID primitive.ObjectID, code, ip, userAgent string) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{
+			"_id": userID,
+			"recovery_codes": bson.M{"$elemMatch": bson.M{
+				"hash":    hashRecoveryCode(code),
+				"used_at": nil,
+			}},
+		},
+		bson.M{"$set": bson.M{
+			"recovery_codes.$.used_at":         time.Now(),
+			"recovery_codes.$.used_ip":         ip,
+			"recovery_codes.$.used_user_agent": userAgent,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrInvalidRecoveryCode
+	}
+	return nil
+}
+
+// MarkEmailVerified confirms the user's address, provided it is still the
+// address the verification was issued for.
+func (s *UserService) MarkEmailVerified(userID primitive.ObjectID, email string) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID, "email": email},
+		bson.M{"$set": bson.M{"email_verified": true}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
+
+// ResumePendingRegistration restarts an unfinished registration, taking the
+// newly submitted name and restarting the reaper's clock.
+func (s *UserService) ResumePendingRegistration(user *User, name string) error {
+	user.Name = name
+	user.DisplayName = name
+	user.CreatedAt = time.Now()
+
+	_, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": user.ID, "pending": true},
+		bson.M{"$set": bson.M{
+			"name":         user.Name,
+			"display_name": user.DisplayName,
+			"created_at":   user.CreatedAt,
+		}},
+	)
+	return err
+}
+
+// DeletePendingUsers removes registrations that were started before cutoff
+// and never completed a passkey ceremony.
+func (s *UserService) DeletePendingUsers(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := s.collection.DeleteMany(ctx, bson.M{
+		"pending":    true,
+		"created_at": bson.M{"$lt": cutoff},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// ListUsers returns a page of users, oldest first, and the total count.
+func (s *UserService) ListUsers(ctx context.Context, skip, limit int64) ([]User, int64, error) {
+	total, err := s.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (s *UserService) SetRole(userID primitive.ObjectID, role Role) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"role": role}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// BootstrapAdmin promotes the account with the given email to admin while no
+// admin exists yet. The address must be verified, so nobody can claim the
+// role by registering the configured email first.
+func (s *UserService) BootstrapAdmin(ctx context.Context, email string) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+
+	admins, err := s.collection.CountDocuments(ctx, bson.M{"role": RoleAdmin})
+	if err != nil || admins > 0 {
+		return false, err
+	}
+
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"email": email, "email_verified": true, "pending": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"role": RoleAdmin}},
+		options.Update().SetCollation(emailCollation),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (s *UserService) AddAccessToken(userID primitive.ObjectID, token AccessToken) error {
+	_, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$push": bson.M{"access_tokens": token}},
+	)
+	return err
+}
+
+func (s *UserService) RevokeAccessToken(userID, tokenID primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"access_tokens": bson.M{"id": tokenID}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// GetUserByAccessToken finds the owner of an unexpired access token and
+// records that the token was used.
+func (s *UserService) GetUserByAccessToken(ctx context.Context, plain string) (*User, *AccessToken, error) {
+	hash := HashAccessToken(plain)
+	now := time.Now()
+
+	var user User
+	err := s.collection.FindOne(ctx, bson.M{
+		"access_tokens": bson.M{"$elemMatch": bson.M{
+			"hash":       hash,
+			"expires_at": bson.M{"$gt": now},
+		}},
+	}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrAccessTokenNotFound
+		}
+		return nil, nil, err
+	}
+
+	var token *AccessToken
+	for i := range user.AccessTokens {
+		if user.AccessTokens[i].Hash == hash {
+			token = &user.AccessTokens[i]
+		}
+	}
+	if token == nil {
+		return nil, nil, ErrAccessTokenNotFound
+	}
+
+	// Bots call in tight loops; a minute of precision is plenty
+	if now.Sub(token.LastUsedAt) > time.Minute {
+		token.LastUsedAt = now
+		_, err = s.collection.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "access_tokens.id": token.ID},
+			bson.M{"$set": bson.M{"access_tokens.$.last_used_at": now}},
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return &user, token, nil
+}
+
+// UpdateDisplayName sets the name the user is shown with.
+func (s *UserService) UpdateDisplayName(ctx context.Context, userID primitive.ObjectID, displayName string) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"display_name": displayName}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// RequestEmailChange records newEmail as the address the user wants to move
+// to, provided no other account uses it. The current address stays in
+// effect until ConfirmEmailChange.
+func (s *UserService) RequestEmailChange(ctx context.Context, userID primitive.ObjectID, newEmail string) error {
+	taken, err := s.collection.CountDocuments(ctx,
+		bson.M{"email": newEmail, "_id": bson.M{"$ne": userID}},
+		options.Count().SetCollation(emailCollation).SetLimit(1),
+	)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrEmailTaken
+	}
+
+	_, err = s.collection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"pending_email": newEmail}},
+	)
+	return err
+}
+
+// ConfirmEmailChange moves the user to newEmail, which counts as verified
+// since the link reached it. It only applies while newEmail is still the
+// pending address, so a newer request supersedes older links.
+func (s *UserService) ConfirmEmailChange(ctx context.Context, userID primitive.ObjectID, newEmail string) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": userID, "pending_email": newEmail},
+		bson.M{
+			"$set":   bson.M{"email": newEmail, "email_verified": true},
+			"$unset": bson.M{"pending_email": ""},
+		},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
+
+// AddCreatedPolls lists polls under the user, for polls handed over from
+// another account.
+func (s *UserService) AddCreatedPolls(ctx context.Context, userID primitive.ObjectID, pollIDs []primitive.ObjectID) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$addToSet": bson.M{"created_polls": bson.M{"$each": pollIDs}}},
+	)
+	return err
+}
+
+// RemoveCreatedPoll drops a deleted poll from the user's CreatedPolls.
+func (s *UserService) RemoveCreatedPoll(ctx context.Context, userID, pollID primitive.ObjectID) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"created_polls": pollID}},
+	)
+	return err
+}
+
+// DeleteUser removes the account document. Callers take care of the
+// user's polls, votes and sessions first.
+func (s *UserService) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
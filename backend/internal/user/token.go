@@ -0,0 +1,84 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessTokenPrefix marks personal access tokens so the auth middleware can
+// tell them apart from session tokens, and so leaked tokens are easy to grep.
+const AccessTokenPrefix = "pat_"
+
+type Scope string
+
+const (
+	ScopePollsRead Scope = "polls:read"
+	// ScopePollsWrite covers creating and changing polls. Deleting one
+	// takes a fresh passkey login, so access tokens cannot do it.
+	ScopePollsWrite Scope = "polls:write"
+	ScopeVotesWrite Scope = "votes:write"
+)
+
+// Valid reports whether s is one of the known scopes.
+func (s Scope) Valid() bool {
+	switch s {
+	case ScopePollsRead, ScopePollsWrite, ScopeVotesWrite:
+		return true
+	}
+	return false
+}
+
+// AccessToken is a named, scoped API token for scripts and bots. Only the
+// hash of the secret is stored.
+type AccessToken struct {
+	ID         primitive.ObjectID `bson:"id" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Hash       string             `bson:"hash" json:"-"`
+	Scopes     []Scope            `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt  time.Time          `bson:"expires_at" json:"expires_at"`
+	LastUsedAt time.Time          `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *AccessToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// newAccessToken returns the plain token, shown to the user once, and the
+// record to store.
+func newAccessToken(name string, scopes []Scope, ttl time.Duration) (string, AccessToken, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", AccessToken{}, err
+	}
+	plain := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := time.Now()
+	return plain, AccessToken{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Hash:      HashAccessToken(plain),
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, nil
+}
+
+// HashAccessToken returns the stored form of a plain token. The secret is
+// 256 random bits, so a fast hash is enough.
+func HashAccessToken(plain string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(plain)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,26 @@
+package user
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAccessToken(t *testing.T) {
+	plain, token, err := newAccessToken("ci", []Scope{ScopePollsWrite}, time.Hour)
+	if err != nil {
+		t.Fatalf("newAccessToken returned error: %v", err)
+	}
+	if !strings.HasPrefix(plain, AccessTokenPrefix) {
+		t.Errorf("expected token to start with %q; got %q", AccessTokenPrefix, plain)
+	}
+	if token.Hash != HashAccessToken(plain) || strings.Contains(token.Hash, plain) {
+		t.Errorf("expected the record to hold only the hash of the token")
+	}
+	if !token.HasScope(ScopePollsWrite) || token.HasScope(ScopeVotesWrite) {
+		t.Errorf("unexpected scopes %v", token.Scopes)
+	}
+	if !token.ExpiresAt.After(token.CreatedAt) {
+		t.Errorf("expected expiry after creation")
+	}
+}
@@ -0,0 +1,92 @@
+package user
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/mail"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type recordingMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestEmailVerifierRoundTrip(t *testing.T) {
+	mailer := &recordingMailer{}
+	v := NewEmailVerifier([]byte("secret"), time.Hour, mailer, "http://localhost:3000/verify-email")
+	userID := primitive.NewObjectID()
+
+	if err := v.SendVerification(context.Background(), userID, "ada@example.com"); err != nil {
+		t.Fatalf("SendVerification returned error: %v", err)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "ada@example.com" {
+		t.Fatalf("expected one message to ada@example.com; got %+v", mailer.sent)
+	}
+
+	token, err := v.issue(PurposeVerifyEmail, userID, "ada@example.com")
+	if err != nil {
+		t.Fatalf("issue returned error: %v", err)
+	}
+	if !strings.Contains(mailer.sent[0].Body, "?token=") {
+		t.Errorf("expected the message to contain a verification link")
+	}
+
+	got, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if got.UserID != userID || got.Email != "ada@example.com" || got.Purpose != PurposeVerifyEmail {
+		t.Errorf("unexpected claims %+v", got)
+	}
+}
+
+func TestEmailVerifierChangeEmail(t *testing.T) {
+	mailer := &recordingMailer{}
+	v := NewEmailVerifier([]byte("secret"), time.Hour, mailer, "http://localhost:3000/verify-email")
+	userID := primitive.NewObjectID()
+
+	if err := v.SendEmailChange(context.Background(), userID, "new@example.com"); err != nil {
+		t.Fatalf("SendEmailChange returned error: %v", err)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "new@example.com" {
+		t.Fatalf("expected one message to new@example.com; got %+v", mailer.sent)
+	}
+
+	token, _ := v.issue(PurposeChangeEmail, userID, "new@example.com")
+	got, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if got.Purpose != PurposeChangeEmail || got.Email != "new@example.com" {
+		t.Errorf("unexpected claims %+v", got)
+	}
+}
+
+func TestEmailVerifierRejectsBadTokens(t *testing.T) {
+	v := NewEmailVerifier([]byte("secret"), time.Hour, &recordingMailer{}, "")
+	expired := NewEmailVerifier([]byte("secret"), -time.Minute, &recordingMailer{}, "")
+	other := NewEmailVerifier([]byte("other"), time.Hour, &recordingMailer{}, "")
+
+	expiredToken, _ := expired.issue(PurposeVerifyEmail, primitive.NewObjectID(), "a@example.com")
+	forgedToken, _ := other.issue(PurposeVerifyEmail, primitive.NewObjectID(), "a@example.com")
+	unknownToken, _ := v.issue("reset-password", primitive.NewObjectID(), "a@example.com")
+
+	for name, token := range map[string]string{
+		"expired": expiredToken,
+		"forged":  forgedToken,
+		"purpose": unknownToken,
+		"garbage": "abc",
+	} {
+		if _, err := v.Verify(token); err != ErrInvalidVerificationToken {
+			t.Errorf("%s: expected ErrInvalidVerificationToken; got %v", name, err)
+		}
+	}
+}
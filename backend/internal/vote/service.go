@@ -86,3 +86,62 @@ func (s *VoteService) GetVotesForPoll(ctx context.Context, pollID primitive.Obje
 
 	return votes, nil
 }
+
+// GetVotesByUser returns every ballot the user has cast.
+func (s *VoteService) GetVotesByUser(ctx context.Context, userID primitive.ObjectID) ([]Vote, error) {
+	cursor, err := s.voteCollection.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	votes := []Vote{}
+	if err = cursor.All(ctx, &votes); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+// CountVotesForPoll returns how many ballots were cast on a poll.
+func (s *VoteService) CountVotesForPoll(ctx context.Context, pollID primitive.ObjectID) (int64, error) {
+	return s.voteCollection.CountDocuments(ctx, bson.M{"poll_id": pollID})
+}
+
+// RemoveVotesByUser deletes the user's ballots and returns them, so the
+// caller can take them off the poll tallies.
+func (s *VoteService) RemoveVotesByUser(ctx context.Context, userID primitive.ObjectID) ([]Vote, error) {
+	votes, err := s.GetVotesByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.voteCollection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return nil, err
+	}
+	return votes, nil
+}
+
+// AnonymizeVotesByUser detaches the user's ballots from them. The ballots
+// still count, so tallies do not change.
+func (s *VoteService) AnonymizeVotesByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := s.voteCollection.UpdateMany(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"user_id": primitive.NilObjectID}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// DeleteVotesForPoll removes every ballot cast on a poll.
+func (s *VoteService) DeleteVotesForPoll(ctx context.Context, pollID primitive.ObjectID) error {
+	_, err := s.voteCollection.DeleteMany(ctx, bson.M{"poll_id": pollID})
+	return err
+}
+
+// RemoveVote deletes one user's ballot on a poll.
+func (s *VoteService) RemoveVote(ctx context.Context, pollID, userID primitive.ObjectID) error {
+	_, err := s.voteCollection.DeleteOne(ctx, bson.M{"poll_id": pollID, "user_id": userID})
+	return err
+}
@@ -0,0 +1,23 @@
+package workspace
+
+import "context"
+
+type contextKey struct{}
+
+type access struct {
+	workspace *Workspace
+	member    *Member
+}
+
+// NewContext returns a copy of ctx carrying the workspace named in the URL
+// and the caller's membership of it.
+func NewContext(ctx context.Context, w *Workspace, m *Member) context.Context {
+	return context.WithValue(ctx, contextKey{}, access{workspace: w, member: m})
+}
+
+// FromContext returns the workspace and membership stored in ctx by the
+// membership middleware, if any.
+func FromContext(ctx context.Context) (*Workspace, *Member, bool) {
+	a, ok := ctx.Value(contextKey{}).(access)
+	return a.workspace, a.member, ok
+}
@@ -0,0 +1,315 @@
+package workspace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/audit"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxNameLength = 64
+
+type WorkspaceHandler struct {
+	workspaceService *WorkspaceService
+	auditLog         *audit.AuditService
+}
+
+func NewWorkspaceHandler(workspaceService *WorkspaceService, auditLog *audit.AuditService) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceService: workspaceService,
+		auditLog:         auditLog,
+	}
+}
+
+// CreateWorkspace creates a workspace with the caller as its owner. The slug
+// is derived from the name unless one is given.
+func (h *WorkspaceHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		http.Error(w, "Name must be between 1 and 64 characters", http.StatusBadRequest)
+		return
+	}
+	slug := req.Slug
+	if slug == "" {
+		slug = Slugify(name)
+	}
+	if !ValidSlug(slug) {
+		http.Error(w, "Slug must be 3 to 40 lowercase letters, digits or dashes", http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := h.workspaceService.CreateWorkspace(r.Context(), name, slug, caller.ID)
+	if err == ErrSlugTaken {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionWorkspaceCreate, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).On(audit.TargetWorkspace, workspace.ID.Hex()))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Membership{Workspace: *workspace, Role: RoleOwner})
+}
+
+// ListWorkspaces returns the workspaces the caller belongs to.
+func (h *WorkspaceHandler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	memberships, err := h.workspaceService.ListForUser(r.Context(), caller.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(memberships)
+}
+
+// GetWorkspace returns the workspace in the URL and the caller's role in it.
+func (h *WorkspaceHandler) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspace, member, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Membership{Workspace: *workspace, Role: member.Role})
+}
+
+func (h *WorkspaceHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	workspace, _, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	members, err := h.workspaceService.ListMembers(r.Context(), workspace.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// RemoveMember lets an owner remove anyone, and any member leave.
+func (h *WorkspaceHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	caller, _ := user.FromContext(r.Context())
+	workspace, member, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if userID != caller.ID && member.Role != RoleOwner {
+		http.Error(w, "Only owners can remove other members", http.StatusForbidden)
+		return
+	}
+
+	switch err := h.workspaceService.RemoveMember(r.Context(), workspace.ID, userID); err {
+	case nil:
+	case ErrMemberNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case ErrLastOwner:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionMemberRemove, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetWorkspace, workspace.ID.Hex()).
+		With("user_id", userID.Hex()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Invite mails an invitation to join the workspace. Only owners can invite.
+func (h *WorkspaceHandler) Invite(w http.ResponseWriter, r *http.Request) {
+	caller, _ := user.FromContext(r.Context())
+	workspace, member, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if member.Role != RoleOwner {
+		http.Error(w, "Only owners can invite members", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  Role   `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil || addr.Name != "" {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleMember
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.workspaceService.Invite(r.Context(), workspace, addr.Address, req.Role, caller)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionWorkspaceInvite, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetWorkspace, workspace.ID.Hex()).
+		With("email", invitation.Email).
+		With("role", string(invitation.Role)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func (h *WorkspaceHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	workspace, member, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if member.Role != RoleOwner {
+		http.Error(w, "Only owners can see invitations", http.StatusForbidden)
+		return
+	}
+
+	invitations, err := h.workspaceService.ListInvitations(r.Context(), workspace.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (h *WorkspaceHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	caller, _ := user.FromContext(r.Context())
+	workspace, member, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if member.Role != RoleOwner {
+		http.Error(w, "Only owners can revoke invitations", http.StatusForbidden)
+		return
+	}
+
+	invitationID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.workspaceService.RevokeInvitation(r.Context(), workspace.ID, invitationID)
+	if err == ErrInvitationNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionInvitationRevoke, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetWorkspace, workspace.ID.Hex()).
+		With("invitation_id", invitationID.Hex()))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptInvitation redeems the token from an invitation email for the
+// signed-in caller.
+func (h *WorkspaceHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	caller, ok := user.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspace, invitation, err := h.workspaceService.AcceptInvitation(r.Context(), req.Token, caller)
+	switch err {
+	case nil:
+	case ErrInvitationNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case ErrInvitationEmail:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.auditLog.Record(r.Context(), audit.NewEvent(r, audit.ActionWorkspaceJoin, audit.OutcomeSuccess).
+		By(caller.ID, caller.Email).
+		On(audit.TargetWorkspace, workspace.ID.Hex()).
+		With("invitation_id", invitation.ID.Hex()))
+
+	// Someone who was already a member keeps the role they had
+	_, member, err := h.workspaceService.Membership(r.Context(), workspace.Slug, caller.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Membership{Workspace: *workspace, Role: member.Role})
+}
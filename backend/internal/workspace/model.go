@@ -0,0 +1,119 @@
+package workspace
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Role string
+
+const (
+	// RoleOwner manages members and invitations.
+	RoleOwner Role = "owner"
+	// RoleMember creates polls and votes.
+	RoleMember Role = "member"
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	return r == RoleOwner || r == RoleMember
+}
+
+// Workspace groups users and the polls they share. Its slug is the
+// workspace's part of every URL under it.
+type Workspace struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Slug      string             `bson:"slug" json:"slug"`
+	Name      string             `bson:"name" json:"name"`
+	CreatedBy primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Member is one user's place in one workspace. A user may be a member of
+// any number of workspaces.
+type Member struct {
+	WorkspaceID primitive.ObjectID `bson:"workspace_id" json:"workspace_id"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Role        Role               `bson:"role" json:"role"`
+	JoinedAt    time.Time          `bson:"joined_at" json:"joined_at"`
+}
+
+// MemberView is a member as listed to the rest of the workspace.
+type MemberView struct {
+	Member
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Membership is a workspace as listed to one of its members.
+type Membership struct {
+	Workspace
+	Role Role `json:"role"`
+}
+
+// Invitation lets whoever owns Email join a workspace. Only the hash of the
+// token is stored; the plain token is in the mailed link.
+type Invitation struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	WorkspaceID primitive.ObjectID `bson:"workspace_id" json:"workspace_id"`
+	Email       string             `bson:"email" json:"email"`
+	Role        Role               `bson:"role" json:"role"`
+	Hash        string             `bson:"hash" json:"-"`
+	InvitedBy   primitive.ObjectID `bson:"invited_by" json:"invited_by"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time          `bson:"expires_at" json:"expires_at"`
+}
+
+// newInvitationToken returns a plain invitation token and its stored hash.
+func newInvitationToken() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	plain := base64.RawURLEncoding.EncodeToString(secret)
+	return plain, hashInvitationToken(plain), nil
+}
+
+func hashInvitationToken(plain string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(plain)))
+	return hex.EncodeToString(sum[:])
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,38}[a-z0-9]$`)
+
+// ValidSlug reports whether slug can name a workspace in URLs.
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+// Slugify derives a slug from a workspace name, or returns "" if the name
+// has too few letters or digits to make one.
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimRight(b.String(), "-")
+	if len(slug) > 40 {
+		slug = strings.TrimRight(slug[:40], "-")
+	}
+	if !ValidSlug(slug) {
+		return ""
+	}
+	return slug
+}
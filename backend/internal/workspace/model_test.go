@@ -0,0 +1,36 @@
+package workspace
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Design Team":        "design-team",
+		"  R&D -- Europe!  ": "r-d-europe",
+		"ab":                 "",
+		"!!!":                "",
+		"a very long workspace name that keeps going on": "a-very-long-workspace-name-that-keeps-go",
+	}
+	for name, want := range cases {
+		if got := Slugify(name); got != want {
+			t.Errorf("%q: expected %q; got %q", name, want, got)
+		}
+	}
+}
+
+func TestValidSlug(t *testing.T) {
+	cases := map[string]bool{
+		"general":    true,
+		"team-42":    true,
+		"-team":      false,
+		"team-":      false,
+		"Team":       false,
+		"te":         false,
+		"team/polls": false,
+		"team_polls": false,
+	}
+	for slug, want := range cases {
+		if got := ValidSlug(slug); got != want {
+			t.Errorf("%q: expected %v; got %v", slug, want, got)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/mail"
+	"github.com/SaiKiranMatta/nextjs-golang-polling-application/backend/internal/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWorkspaceNotFound  = errors.New("Workspace not found")
+	ErrSlugTaken          = errors.New("Workspace slug is taken")
+	ErrMemberNotFound     = errors.New("Member not found")
+	ErrLastOwner          = errors.New("A workspace needs at least one owner")
+	ErrInvitationNotFound = errors.New("Invitation not found or expired")
+	ErrInvitationEmail    = errors.New("This invitation was sent to a different email address")
+)
+
+// invitationTTL is how long an emailed invitation stays usable.
+const invitationTTL = 7 * 24 * time.Hour
+
+type WorkspaceService struct {
+	workspaces  *mongo.Collection
+	members     *mongo.Collection
+	invitations *mongo.Collection
+	userService *user.UserService
+	mailer      mail.Mailer
+	acceptURL   string
+}
+
+func NewWorkspaceService(db *mongo.Database, userService *user.UserService, mailer mail.Mailer, acceptURL string) *WorkspaceService {
+	return &WorkspaceService{
+		workspaces:  db.Collection("workspaces"),
+		members:     db.Collection("workspace_members"),
+		invitations: db.Collection("workspace_invitations"),
+		userService: userService,
+		mailer:      mailer,
+		acceptURL:   acceptURL,
+	}
+}
+
+func (s *WorkspaceService) EnsureIndexes(ctx context.Context) error {
+	if _, err := s.workspaces.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		return err
+	}
+	if _, err := s.members.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "workspace_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+	_, err := s.invitations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "email", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// CreateWorkspace creates a workspace owned by its creator.
+func (s *WorkspaceService) CreateWorkspace(ctx context.Context, name, slug string, owner primitive.ObjectID) (*Workspace, error) {
+	workspace := &Workspace{
+		ID:        primitive.NewObjectID(),
+		Slug:      slug,
+		Name:      name,
+		CreatedBy: owner,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.workspaces.InsertOne(ctx, workspace); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
+	}
+	if err := s.AddMember(ctx, workspace.ID, owner, RoleOwner); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+// EnsureWorkspace returns the workspace with slug, creating it without an
+// owner if it does not exist yet. Concurrent callers get the same one.
+func (s *WorkspaceService) EnsureWorkspace(ctx context.Context, slug, name string) (*Workspace, error) {
+	var workspace Workspace
+	err := s.workspaces.FindOneAndUpdate(ctx,
+		bson.M{"slug": slug},
+		bson.M{"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "name": name, "created_at": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&workspace)
+	if mongo.IsDuplicateKeyError(err) {
+		// Lost the race to another instance; theirs is the one
+		return s.GetWorkspace(ctx, slug)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+func (s *WorkspaceService) GetWorkspace(ctx context.Context, slug string) (*Workspace, error) {
+	var workspace Workspace
+	err := s.workspaces.FindOne(ctx, bson.M{"slug": slug}).Decode(&workspace)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// Membership resolves the workspace with slug and userID's membership of it.
+// Non-members get ErrWorkspaceNotFound, so they cannot tell which
+// workspaces exist.
+func (s *WorkspaceService) Membership(ctx context.Context, slug string, userID primitive.ObjectID) (*Workspace, *Member, error) {
+	workspace, err := s.GetWorkspace(ctx, slug)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.membership(ctx, workspace, userID)
+}
+
+// MembershipByID is Membership for a workspace known by its ID.
+func (s *WorkspaceService) MembershipByID(ctx context.Context, workspaceID, userID primitive.ObjectID) (*Workspace, *Member, error) {
+	var workspace Workspace
+	err := s.workspaces.FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&workspace)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.membership(ctx, &workspace, userID)
+}
+
+func (s *WorkspaceService) membership(ctx context.Context, workspace *Workspace, userID primitive.ObjectID) (*Workspace, *Member, error) {
+	var member Member
+	err := s.members.FindOne(ctx, bson.M{"workspace_id": workspace.ID, "user_id": userID}).Decode(&member)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return workspace, &member, nil
+}
+
+// ListForUser returns every workspace userID belongs to, oldest membership
+// first.
+func (s *WorkspaceService) ListForUser(ctx context.Context, userID primitive.ObjectID) ([]Membership, error) {
+	cursor, err := s.members.Find(ctx, bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var members []Member
+	if err = cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(members))
+	for i, m := range members {
+		ids[i] = m.WorkspaceID
+	}
+	cursor, err = s.workspaces.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var workspaces []Workspace
+	if err = cursor.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]Workspace, len(workspaces))
+	for _, w := range workspaces {
+		byID[w.ID] = w
+	}
+
+	memberships := []Membership{}
+	for _, m := range members {
+		if w, ok := byID[m.WorkspaceID]; ok {
+			memberships = append(memberships, Membership{Workspace: w, Role: m.Role})
+		}
+	}
+	return memberships, nil
+}
+
+// ListMembers returns the members of a workspace with their names and
+// email addresses, in the order they joined.
+func (s *WorkspaceService) ListMembers(ctx context.Context, workspaceID primitive.ObjectID) ([]MemberView, error) {
+	cursor, err := s.members.Find(ctx, bson.M{"workspace_id": workspaceID},
+		options.Find().SetSort(bson.D{{Key: "joined_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var members []Member
+	if err = cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(members))
+	for i, m := range members {
+		ids[i] = m.UserID
+	}
+	users, err := s.userService.GetUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]user.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	views := make([]MemberView, len(members))
+	for i, m := range members {
+		u := byID[m.UserID]
+		views[i] = MemberView{Member: m, Name: u.DisplayName, Email: u.Email}
+	}
+	return views, nil
+}
+
+// AddMember adds userID to a workspace. Adding an existing member is not an
+// error and leaves their role alone.
+func (s *WorkspaceService) AddMember(ctx context.Context, workspaceID, userID primitive.ObjectID, role Role) error {
+	_, err := s.members.InsertOne(ctx, Member{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        role,
+		JoinedAt:    time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// RemoveMember takes userID out of a workspace, unless they are its last
+// owner.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, workspaceID, userID primitive.ObjectID) error {
+	var member Member
+	err := s.members.FindOne(ctx, bson.M{"workspace_id": workspaceID, "user_id": userID}).Decode(&member)
+	if err == mongo.ErrNoDocuments {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if member.Role == RoleOwner {
+		owners, err := s.members.CountDocuments(ctx, bson.M{"workspace_id": workspaceID, "role": RoleOwner})
+		if err != nil {
+			return err
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	_, err = s.members.DeleteOne(ctx, bson.M{"workspace_id": workspaceID, "user_id": userID})
+	return err
+}
+
+// RemoveUser takes a deleted account out of every workspace. Where it was
+// the last owner, the longest-standing remaining member takes over.
+func (s *WorkspaceService) RemoveUser(ctx context.Context, userID primitive.ObjectID) error {
+	cursor, err := s.members.Find(ctx, bson.M{"user_id": userID, "role": RoleOwner})
+	if err != nil {
+		return err
+	}
+	var owned []Member
+	if err = cursor.All(ctx, &owned); err != nil {
+		return err
+	}
+
+	if _, err := s.members.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+
+	for _, m := range owned {
+		owners, err := s.members.CountDocuments(ctx, bson.M{"workspace_id": m.WorkspaceID, "role": RoleOwner})
+		if err != nil {
+			return err
+		}
+		if owners > 0 {
+			continue
+		}
+		var heir Member
+		err = s.members.FindOne(ctx, bson.M{"workspace_id": m.WorkspaceID},
+			options.FindOne().SetSort(bson.D{{Key: "joined_at", Value: 1}})).Decode(&heir)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = s.members.UpdateOne(ctx,
+			bson.M{"workspace_id": heir.WorkspaceID, "user_id": heir.UserID},
+			bson.M{"$set": bson.M{"role": RoleOwner}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invite emails email a link to join workspace. A newer invitation for the
+// same address replaces the older one.
+func (s *WorkspaceService) Invite(ctx context.Context, workspace *Workspace, email string, role Role, invitedBy *user.User) (*Invitation, error) {
+	plain, hash, err := newInvitationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invitation := &Invitation{
+		ID:          primitive.NewObjectID(),
+		WorkspaceID: workspace.ID,
+		Email:       strings.ToLower(email),
+		Role:        role,
+		Hash:        hash,
+		InvitedBy:   invitedBy.ID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(invitationTTL),
+	}
+	if _, err := s.invitations.DeleteMany(ctx, bson.M{"workspace_id": workspace.ID, "email": invitation.Email}); err != nil {
+		return nil, err
+	}
+	if _, err := s.invitations.InsertOne(ctx, invitation); err != nil {
+		return nil, err
+	}
+
+	link := s.acceptURL + "?token=" + url.QueryEscape(plain)
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Join %s", workspace.Name),
+		Body: fmt.Sprintf("%s invited you to the %s workspace. Open this link to join:\n\n%s\n\n"+
+			"The link expires in %s. Sign in or create an account with this email address first.\n",
+			invitedBy.DisplayName, workspace.Name, link, invitationTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// ListInvitations returns a workspace's unexpired invitations, newest first.
+func (s *WorkspaceService) ListInvitations(ctx context.Context, workspaceID primitive.ObjectID) ([]Invitation, error) {
+	cursor, err := s.invitations.Find(ctx,
+		bson.M{"workspace_id": workspaceID, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	invitations := []Invitation{}
+	if err = cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (s *WorkspaceService) RevokeInvitation(ctx context.Context, workspaceID, invitationID primitive.ObjectID) error {
+	result, err := s.invitations.DeleteOne(ctx, bson.M{"_id": invitationID, "workspace_id": workspaceID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation makes u a member of the workspace the token invites to.
+// The invitation only works for the account holding the invited address.
+func (s *WorkspaceService) AcceptInvitation(ctx context.Context, token string, u *user.User) (*Workspace, *Invitation, error) {
+	var invitation Invitation
+	err := s.invitations.FindOne(ctx, bson.M{
+		"hash":       hashInvitationToken(token),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.EqualFold(invitation.Email, u.Email) {
+		return nil, nil, ErrInvitationEmail
+	}
+
+	var workspace Workspace
+	err = s.workspaces.FindOne(ctx, bson.M{"_id": invitation.WorkspaceID}).Decode(&workspace)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.AddMember(ctx, workspace.ID, u.ID, invitation.Role); err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.invitations.DeleteOne(ctx, bson.M{"_id": invitation.ID}); err != nil {
+		return nil, nil, err
+	}
+	return &workspace, &invitation, nil
+}
@@ -1,3 +1,4 @@
+import { forwardedFor } from "@/lib/forwarded";
 import { NextResponse } from "next/server";
 
 export const POST = async (request: Request) => {
@@ -5,7 +6,10 @@ export const POST = async (request: Request) => {
     const backendUrl = process.env.BACKEND_URL;
     const response = await fetch(`${backendUrl}/login/begin`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
+        headers: {
+            "Content-Type": "application/json",
+            ...forwardedFor(request),
+        },
         body: JSON.stringify({ email }),
     });
 
@@ -1,3 +1,4 @@
+import { forwardedFor } from "@/lib/forwarded";
 import { NextResponse } from "next/server";
 
 export const POST = async (request: Request) => {
@@ -5,11 +6,19 @@ export const POST = async (request: Request) => {
     const backendUrl = process.env.BACKEND_URL;
     const response = await fetch(`${backendUrl}/login/finish`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
+        headers: {
+            "Content-Type": "application/json",
+            ...forwardedFor(request),
+        },
         body: JSON.stringify({ email, data }),
     });
 
-    return new NextResponse(null, {
+    // The body carries the session token the sign-in has to hand on to
+    // /auth/verify.
+    const responseBody = await response.text();
+
+    return new NextResponse(responseBody, {
         status: response.status,
+        headers: { "Content-Type": "application/json" },
     });
 };
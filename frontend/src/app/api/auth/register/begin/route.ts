@@ -1,3 +1,4 @@
+import { forwardedFor } from "@/lib/forwarded";
 import { NextResponse } from "next/server";
 
 export const POST = async (request: Request) => {
@@ -6,7 +7,10 @@ export const POST = async (request: Request) => {
 
     const response = await fetch(`${backendUrl}/register/begin`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
+        headers: {
+            "Content-Type": "application/json",
+            ...forwardedFor(request),
+        },
         body: JSON.stringify({ name, email }),
     });
 
@@ -1,3 +1,4 @@
+import { forwardedFor } from "@/lib/forwarded";
 import { NextResponse } from "next/server";
 
 export const POST = async (request: Request) => {
@@ -7,16 +8,20 @@ export const POST = async (request: Request) => {
 
         const response = await fetch(`${backendUrl}/register/finish`, {
             method: "POST",
-            headers: { "Content-Type": "application/json" },
+            headers: {
+                "Content-Type": "application/json",
+                ...forwardedFor(request),
+            },
             body: JSON.stringify({ userId, data }),
         });
 
-        const responseBody = await response.text(); // Get the response body as text for logging
-
-        console.log("Response from Go server:", responseBody); // Log the response from Go server
+        // The body carries the session token and recovery codes, so it is
+        // passed through without being logged.
+        const responseBody = await response.text();
 
         return new NextResponse(responseBody, {
             status: response.status,
+            headers: { "Content-Type": "application/json" },
         });
     } catch (err: any) {
         return new NextResponse(`Error: ${err.message}`, { status: 500 });
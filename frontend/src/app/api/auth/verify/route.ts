@@ -1,15 +1,20 @@
+import { forwardedFor } from "@/lib/forwarded";
 import { NextResponse } from "next/server";
 
 export const POST = async (request: Request) => {
-    const { email, action } = await request.json();
+    const { email, action, token } = await request.json();
     const backendUrl = process.env.BACKEND_URL;
     const response = await fetch(`${backendUrl}/auth/verify`, {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
+        headers: {
+            "Content-Type": "application/json",
+            ...forwardedFor(request),
+            Authorization: `Bearer ${token}`,
+        },
         body: JSON.stringify({ email, action }),
     });
 
-    const data = await response.json();
+    const data = response.ok ? await response.json() : null;
 
     return NextResponse.json({
         data,
@@ -1,3 +1,4 @@
+import { backendFetch } from "@/lib/backend";
 import { NextResponse } from "next/server";
 
 export const GET = async (
@@ -6,18 +7,16 @@ export const GET = async (
 ) => {
     const { pollId } = params;
 
-    const url = new URL(request.url);
-    const userId = url.searchParams.get("userId");
-
-    const backendUrl = process.env.BACKEND_URL;
-
     try {
-        const response = await fetch(
-            `${backendUrl}/polls/${pollId}?userId=${userId}`,
-            {
-                method: "GET",
-            }
-        );
+        const response = await backendFetch(`/polls/${pollId}`, {
+            method: "GET",
+        });
+        if (!response) {
+            return NextResponse.json(
+                { error: "Unauthorized" },
+                { status: 401 }
+            );
+        }
 
         if (!response.ok) {
             throw new Error(
@@ -0,0 +1,31 @@
+import { backendFetch } from "@/lib/backend";
+
+export const dynamic = "force-dynamic";
+
+// The browser's EventSource cannot send the backend token, so the stream is
+// relayed from here.
+export const GET = async (
+    request: Request,
+    { params }: { params: { pollId: string } }
+) => {
+    const response = await backendFetch(`/polls/${params.pollId}/stream`, {
+        headers: { Accept: "text/event-stream" },
+        signal: request.signal,
+    });
+    if (!response) {
+        return new Response("Unauthorized", { status: 401 });
+    }
+    if (!response.ok || !response.body) {
+        return new Response(await response.text(), {
+            status: response.status,
+        });
+    }
+
+    return new Response(response.body, {
+        headers: {
+            "Content-Type": "text/event-stream",
+            "Cache-Control": "no-cache",
+            Connection: "keep-alive",
+        },
+    });
+};
@@ -0,0 +1,21 @@
+import { backendFetch } from "@/lib/backend";
+import { NextResponse } from "next/server";
+
+export const POST = async (
+    request: Request,
+    { params }: { params: { pollId: string } }
+) => {
+    const { option_ids } = await request.json();
+    const response = await backendFetch(`/polls/${params.pollId}/vote`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ option_ids }),
+    });
+    if (!response) {
+        return NextResponse.json({ error: "Unauthorized" }, { status: 401 });
+    }
+
+    return new NextResponse(await response.text(), {
+        status: response.status,
+    });
+};
@@ -1,19 +1,34 @@
+import { backendFetch } from "@/lib/backend";
 import { NextResponse } from "next/server";
 
 export const POST = async (request: Request) => {
-    const { question, options, user_id, multiple_choice } =
+    const { workspace, question, options, multiple_choice } =
         await request.json();
-    const backendUrl = process.env.BACKEND_URL;
-    const response = await fetch(`${backendUrl}/polls`, {
-        method: "POST",
-        headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ question, options, user_id, multiple_choice }),
-    });
+    const response = await backendFetch(
+        `/workspaces/${encodeURIComponent(workspace)}/polls`,
+        {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({
+                question,
+                options,
+                multiple_choices: multiple_choice,
+            }),
+        }
+    );
+    if (!response) {
+        return NextResponse.json({ error: "Unauthorized" }, { status: 401 });
+    }
 
-    const data = await response.json();
+    const data = response.ok
+        ? await response.json()
+        : { message: await response.text() };
 
-    return NextResponse.json({
-        data,
-        status: response.status,
-    });
+    return NextResponse.json(
+        {
+            data,
+            status: response.status,
+        },
+        { status: response.status }
+    );
 };
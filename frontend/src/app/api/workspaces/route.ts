@@ -0,0 +1,17 @@
+import { backendFetch } from "@/lib/backend";
+import { NextResponse } from "next/server";
+
+export const GET = async () => {
+    const response = await backendFetch("/workspaces");
+    if (!response) {
+        return NextResponse.json({ error: "Unauthorized" }, { status: 401 });
+    }
+    if (!response.ok) {
+        return NextResponse.json(
+            { error: await response.text() },
+            { status: response.status }
+        );
+    }
+
+    return NextResponse.json({ workspaces: await response.json() });
+};
@@ -21,7 +21,6 @@ interface PollPageProps {
 const PollPage: NextPage<PollPageProps> = ({ params }) => {
     const { data: session, status } = useSession();
     const { verifyPasskey } = usePasskeyAuth();
-    const backendUrl = process.env.NEXT_PUBLIC_BACKEND_URL;
     const [pollData, setPollData] = useState<PollWithUserVote | null>(null);
     const [selectedOptions, setSelectedOptions] = useState<string[]>([]);
     const [initialVote, setInitialVote] = useState<string[]>([]);
@@ -29,12 +28,9 @@ const PollPage: NextPage<PollPageProps> = ({ params }) => {
 
     const fetchPoll = async () => {
         try {
-            const response = await fetch(
-                `/api/polls/${params.pollId}?userId=${session?.user?.id}`,
-                {
-                    method: "GET",
-                }
-            );
+            const response = await fetch(`/api/polls/${params.pollId}`, {
+                method: "GET",
+            });
             const data = await response.json();
             setPollData(data.poll);
             if (data?.poll?.user_vote) {
@@ -51,8 +47,7 @@ const PollPage: NextPage<PollPageProps> = ({ params }) => {
             console.log("Establishing SSE connection...");
 
             const eventSource = new EventSource(
-                `${backendUrl}/polls/${params.pollId}/stream`,
-                { withCredentials: false }
+                `/api/polls/${params.pollId}/stream`
             );
 
             eventSource.onopen = () => {
@@ -62,6 +57,10 @@ const PollPage: NextPage<PollPageProps> = ({ params }) => {
             eventSource.onmessage = (event) => {
                 try {
                     const updatedPoll = JSON.parse(event.data);
+                    if (!Array.isArray(updatedPoll.options)) {
+                        // Status messages such as the greeting on connect
+                        return;
+                    }
                     setPollData((prev) =>
                         prev
                             ? {
@@ -112,13 +111,12 @@ const PollPage: NextPage<PollPageProps> = ({ params }) => {
             if (!isVerified) {
                 return;
             }
-            await fetch(`${backendUrl}/polls/${params.pollId}/vote`, {
+            await fetch(`/api/polls/${params.pollId}/vote`, {
                 method: "POST",
                 headers: {
                     "Content-Type": "application/json",
                 },
                 body: JSON.stringify({
-                    user_id: session?.user?.id,
                     option_ids: selectedOptions,
                 }),
             });
@@ -133,7 +131,7 @@ const PollPage: NextPage<PollPageProps> = ({ params }) => {
         return <div>Loading...</div>;
 
     const handleOptionChange = (optionId: string, isChecked: boolean) => {
-        if (pollData?.multipleChoices) {
+        if (pollData?.multiple_choices) {
             // Handle as checkboxes (multiple choices allowed)
             if (isChecked) {
                 setSelectedOptions([...selectedOptions, optionId]);
@@ -179,7 +177,7 @@ const PollPage: NextPage<PollPageProps> = ({ params }) => {
                             >
                                 <input
                                     type={
-                                        pollData?.multipleChoices
+                                        pollData?.multiple_choices
                                             ? "checkbox"
                                             : "radio"
                                     }
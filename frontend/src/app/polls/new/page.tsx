@@ -24,15 +24,11 @@ const CreatePollPage: NextPage = () => {
         return <div>Loading...</div>;
     }
 
-    // If session is available, pass the user ID to PollForm
-    const user_id = session?.user?.id;
     const email = session?.user?.email;
 
     return (
         <div className=" pt-8">
-            {user_id && email && (
-                <CreatePollForm user_id={user_id} email={email} />
-            )}
+            {email && <CreatePollForm email={email} />}
         </div>
     );
 };
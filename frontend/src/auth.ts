@@ -1,5 +1,6 @@
 import NextAuth from "next-auth";
 import CredentialsProvider from "next-auth/providers/credentials";
+import { forwardedFor } from "@/lib/forwarded";
 const next_auth_url = process.env.NEXTAUTH_URL;
 export const { handlers, signIn, signOut, auth } = NextAuth({
     providers: [
@@ -9,28 +10,42 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
                 email: { label: "Email", type: "text" },
                 name: { label: "Name", type: "text" },
                 action: { label: "Action", type: "hidden" },
+                token: { label: "Token", type: "hidden" },
             },
             async authorize(credentials, req) {
-                const { email, name, action } = credentials as {
+                const { email, action, token } = credentials as {
                     email: string;
                     name: string;
                     action: string;
+                    token: string;
                 };
+                // The backend only confirms an account for the session
+                // that /login/finish or /register/finish just issued.
+                if (!token) {
+                    return null;
+                }
                 const verifyRes = await fetch(
                     `${next_auth_url}/api/auth/verify`,
                     {
                         method: "POST",
-                        headers: { "Content-Type": "application/json" },
-                        body: JSON.stringify({ email, action }),
+                        headers: {
+                            "Content-Type": "application/json",
+                            ...forwardedFor(req),
+                        },
+                        body: JSON.stringify({ email, action, token }),
                     }
                 );
 
                 if (verifyRes.ok) {
                     const userData = await verifyRes.json();
+                    if (userData.status !== 200) {
+                        return null;
+                    }
                     return {
                         id: userData.data.id,
                         email: userData.data.email,
                         name: userData.data.name,
+                        backendToken: token,
                     };
                 }
 
@@ -42,12 +57,14 @@ export const { handlers, signIn, signOut, auth } = NextAuth({
         async jwt({ token, user }) {
             if (user) {
                 token.id = user.id;
+                token.backendToken = user.backendToken;
             }
             return token;
         },
         async session({ session, token }) {
             if (token) {
                 session.user.id = token.id as string;
+                session.backendToken = token.backendToken as string;
             }
             return session;
         },
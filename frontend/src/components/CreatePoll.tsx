@@ -1,5 +1,5 @@
 import { usePasskeyAuth } from "@/hooks/usePasskeyAuth";
-import React, { useState } from "react";
+import React, { useEffect, useState } from "react";
 
 interface PollFormData {
     question: string;
@@ -7,12 +7,16 @@ interface PollFormData {
     multiple_choice: boolean;
 }
 
+interface Workspace {
+    slug: string;
+    name: string;
+}
+
 interface CreatePollFormProps {
-    user_id: string;
     email: string;
 }
 
-const CreatePollForm: React.FC<CreatePollFormProps> = ({ user_id, email }) => {
+const CreatePollForm: React.FC<CreatePollFormProps> = ({ email }) => {
     const [pollData, setPollData] = useState<PollFormData>({
         question: "",
         options: ["", ""], // Starting with two options as default
@@ -21,8 +25,24 @@ const CreatePollForm: React.FC<CreatePollFormProps> = ({ user_id, email }) => {
     const [error, setError] = useState<string | null>(null);
     const [success, setSuccess] = useState<string | null>(null);
     const [isSubmitting, setIsSubmitting] = useState(false);
+    const [workspaces, setWorkspaces] = useState<Workspace[]>([]);
+    const [workspace, setWorkspace] = useState("");
     const { verifyPasskey } = usePasskeyAuth();
 
+    useEffect(() => {
+        // Polls are created in one of the user's workspaces
+        fetch("/api/workspaces")
+            .then((res) => res.json())
+            .then((data) => {
+                const list: Workspace[] = data.workspaces ?? [];
+                setWorkspaces(list);
+                if (list.length > 0) {
+                    setWorkspace(list[0].slug);
+                }
+            })
+            .catch((err) => console.error("Error fetching workspaces:", err));
+    }, []);
+
     const handleInputChange = (
         e: React.ChangeEvent<HTMLInputElement | HTMLTextAreaElement>
     ) => {
@@ -55,6 +75,12 @@ const CreatePollForm: React.FC<CreatePollFormProps> = ({ user_id, email }) => {
         setError(null);
         setSuccess(null);
 
+        if (!workspace) {
+            setError("Join or create a workspace before creating a poll.");
+            setIsSubmitting(false);
+            return;
+        }
+
         // Validate poll data
         if (
             !pollData.question.trim() ||
@@ -84,7 +110,7 @@ const CreatePollForm: React.FC<CreatePollFormProps> = ({ user_id, email }) => {
                 headers: { "Content-Type": "application/json" },
                 body: JSON.stringify({
                     ...pollData,
-                    user_id, // Attach the user ID from session
+                    workspace,
                 }),
             });
 
@@ -98,7 +124,7 @@ const CreatePollForm: React.FC<CreatePollFormProps> = ({ user_id, email }) => {
                     multiple_choice: false,
                 }); // Reset the form
             } else {
-                setError(data.message || "Failed to create poll.");
+                setError(data.data?.message || "Failed to create poll.");
             }
         } catch (err) {
             setError("An error occurred. Please try again.");
@@ -113,6 +139,24 @@ const CreatePollForm: React.FC<CreatePollFormProps> = ({ user_id, email }) => {
                 Create a New Poll
             </h1>
             <form onSubmit={handleSubmit}>
+                <div className="mb-4">
+                    <label className="block text-gray-700 font-medium mb-2">
+                        Workspace:
+                        <select
+                            value={workspace}
+                            onChange={(e) => setWorkspace(e.target.value)}
+                            required
+                            className="mt-1 block w-full p-2 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
+                        >
+                            {workspaces.map((ws) => (
+                                <option key={ws.slug} value={ws.slug}>
+                                    {ws.name}
+                                </option>
+                            ))}
+                        </select>
+                    </label>
+                </div>
+
                 <div className="mb-4">
                     <label className="block text-gray-700 font-medium mb-2">
                         Question:
@@ -32,10 +32,13 @@ export function usePasskeyAuth() {
             });
 
             if (verifyRes.ok) {
-                // Registration successful, now sign in
+                // Registration successful, now sign in with the session
+                // the backend just issued
+                const { token } = await verifyRes.json();
                 const result = await signIn("credentials", {
                     email,
                     name,
+                    token,
                     action: "register",
                     redirect: false,
                 });
@@ -77,9 +80,12 @@ export function usePasskeyAuth() {
             });
 
             if (verifyRes.ok) {
-                // Authentication successful, now sign in
+                // Authentication successful, now sign in with the session
+                // the backend just issued
+                const { token } = await verifyRes.json();
                 const result = await signIn("credentials", {
                     email,
+                    token,
                     action: "login",
                     redirect: false,
                 });
@@ -0,0 +1,23 @@
+import { auth } from "@/auth";
+import { forwardedFor } from "@/lib/forwarded";
+import { headers } from "next/headers";
+
+const backendUrl = process.env.BACKEND_URL;
+
+// backendFetch calls the Go backend as the signed-in user, with the session
+// token it issued at sign-in. It returns null when nobody is signed in.
+export const backendFetch = async (path: string, init: RequestInit = {}) => {
+    const session = await auth();
+    if (!session?.backendToken) {
+        return null;
+    }
+
+    return fetch(`${backendUrl}${path}`, {
+        ...init,
+        headers: {
+            ...init.headers,
+            ...forwardedFor({ headers: headers() }),
+            Authorization: `Bearer ${session.backendToken}`,
+        },
+    });
+};
@@ -0,0 +1,9 @@
+// forwardedFor passes on the browser's address, so the backend's lockouts
+// and audit log see the user rather than this server. The backend only
+// believes it when TRUSTED_PROXIES lists this server.
+export const forwardedFor = (
+    request: { headers: { get(name: string): string | null } }
+): Record<string, string> => {
+    const value = request.headers.get("x-forwarded-for");
+    return value ? { "X-Forwarded-For": value } : {};
+};
@@ -0,0 +1,13 @@
+import "next-auth";
+
+declare module "next-auth" {
+    interface User {
+        // Session token issued by the Go backend, sent as a Bearer token
+        // by the API routes that call it.
+        backendToken?: string;
+    }
+
+    interface Session {
+        backendToken?: string;
+    }
+}
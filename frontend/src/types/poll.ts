@@ -9,7 +9,7 @@ export interface Poll {
     createdBy: ObjectId;
     createdAt: Date;
     votes: Vote[];
-    multipleChoices: boolean;
+    multiple_choices: boolean;
     active: boolean;
 }
 